@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/bitrise-io/go-utils/sliceutil"
+)
+
+const (
+	accelerationPolicyWarn    = "warn"
+	accelerationPolicyFail    = "fail"
+	accelerationPolicyNoAccel = "no-accel"
+)
+
+const kvmDevicePth = "/dev/kvm"
+
+const (
+	accelerationAvailable   = "available"
+	accelerationUnavailable = "unavailable"
+	accelerationUnknown     = "unknown"
+	accelerationNotUsed     = "not_used"
+)
+
+// acceleratedABIs maps the host architectures to the AVD ABIs their hypervisor runs,
+// the other ABIs are emulated without hardware acceleration.
+var acceleratedABIs = map[string][]string{
+	"amd64": {"x86", "x86_64"},
+	"arm64": {"arm64-v8a"},
+}
+
+// accelerationUsed returns whether the emulator uses hardware acceleration to run the ABI on this host.
+func accelerationUsed(abi string) bool {
+	return sliceutil.IsStringInSlice(abi, acceleratedABIs[runtime.GOARCH])
+}
+
+// noAccelInputOption disables hardware acceleration, unless emulator_options sets the acceleration mode itself.
+func noAccelInputOption() inputOption {
+	return inputOption{args: []string{"-no-accel"}, overriddenBy: []string{"-no-accel", "-accel"}}
+}
+
+// accessReadWrite is R_OK | W_OK for syscall.Access.
+const accessReadWrite = 0x4 | 0x2
+
+// accelerationCheckResult holds the outcome of the hardware acceleration preflight.
+type accelerationCheckResult struct {
+	available bool
+	message   string
+}
+
+// checkKVMDevice returns an error if the KVM device is missing or not accessible by the current user.
+func checkKVMDevice() error {
+	if _, err := os.Stat(kvmDevicePth); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s does not exist, the CPU does not support virtualization or the kvm kernel module is not loaded", kvmDevicePth)
+		}
+		return fmt.Errorf("failed to check %s, error: %s", kvmDevicePth, err)
+	}
+
+	if err := syscall.Access(kvmDevicePth, accessReadWrite); err != nil {
+		return fmt.Errorf("%s is not readable and writable by the current user (%s), add the user to the kvm group", kvmDevicePth, err)
+	}
+	return nil
+}
+
+// parseAccelCheckOutput returns the status code and the human readable part of the `emulator -accel-check` output, like:
+// accel:
+// 0
+// KVM (version 12) is installed and usable.
+// accel
+// The status code is 0 if the acceleration is usable, ok is false if the output is not in this format.
+func parseAccelCheckOutput(out string) (code int, message string, ok bool) {
+	lines := strings.Split(out, "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "accel:" {
+			start = i
+			break
+		}
+	}
+	if start == -1 || start+1 >= len(lines) {
+		return 0, "", false
+	}
+
+	code, err := strconv.Atoi(strings.TrimSpace(lines[start+1]))
+	if err != nil {
+		return 0, "", false
+	}
+
+	messageLines := []string{}
+	for _, line := range lines[start+2:] {
+		line = strings.TrimSpace(line)
+		if line == "accel" {
+			break
+		}
+		if line != "" {
+			messageLines = append(messageLines, line)
+		}
+	}
+	return code, strings.Join(messageLines, " "), true
+}
+
+func checkAcceleration(emulator emulatorTool) (accelerationCheckResult, error) {
+	if runtime.GOOS == "linux" {
+		if err := checkKVMDevice(); err != nil {
+			return accelerationCheckResult{available: false, message: err.Error()}, nil
+		}
+	}
+
+	out, err := emulator.AccelCheck()
+	code, message, ok := parseAccelCheckOutput(out)
+	if !ok {
+		if err == nil {
+			err = fmt.Errorf("unexpected output")
+		}
+		return accelerationCheckResult{}, fmt.Errorf("emulator -accel-check failed, output: %s, error: %s", out, err)
+	}
+	return accelerationCheckResult{available: code == 0, message: message}, nil
+}
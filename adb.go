@@ -0,0 +1,28 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/bitrise-io/go-utils/command"
+)
+
+// adbClient runs adb commands against a single device.
+type adbClient struct {
+	binPth string
+	serial string
+}
+
+func newADBClient(androidHome, serial string) adbClient {
+	return adbClient{
+		binPth: filepath.Join(androidHome, "platform-tools", "adb"),
+		serial: serial,
+	}
+}
+
+func (client adbClient) command(args ...string) *command.Model {
+	return command.New(client.binPth, append([]string{"-s", client.serial}, args...)...)
+}
+
+func (client adbClient) shell(args ...string) (string, error) {
+	return client.command(append([]string{"shell"}, args...)...).RunAndReturnTrimmedCombinedOutput()
+}
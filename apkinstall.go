@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+var installFailureRegexp = regexp.MustCompile(`(INSTALL_[A-Z_]*FAILED_[A-Z_]+)(: ?[^\]\n]*)?`)
+
+// apkInstallResult is the outcome of a single install, reported in the boot report.
+type apkInstallResult struct {
+	Paths           []string `json:"paths"`
+	DurationSeconds float64  `json:"duration_seconds"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// parseAPKPaths parses the apk_paths input: one install per line (or per | separated item, like in $BITRISE_APK_PATH_LIST),
+// the comma separated paths of an item are the splits of the same app (installed with install-multiple).
+func parseAPKPaths(value string) [][]string {
+	installs := [][]string{}
+	for _, line := range strings.FieldsFunc(value, func(r rune) bool { return r == '\n' || r == '|' }) {
+		paths := []string{}
+		for _, pth := range strings.Split(line, ",") {
+			if pth = strings.TrimSpace(pth); pth != "" {
+				paths = append(paths, pth)
+			}
+		}
+		if len(paths) > 0 {
+			installs = append(installs, paths)
+		}
+	}
+	return installs
+}
+
+// installFailureReason returns the INSTALL_FAILED_* reason of a failed install's output.
+func installFailureReason(out string) string {
+	if matches := installFailureRegexp.FindStringSubmatch(out); len(matches) > 0 {
+		return strings.TrimSpace(matches[0])
+	}
+	return ""
+}
+
+// installAPK installs the app, replacing the existing one and granting its runtime permissions (API 23+, -g is not known by older pm).
+// Split APKs are installed with install-multiple, which requires API 21+.
+func installAPK(adb adbClient, paths []string, apiLevel int) error {
+	args := []string{"install", "-r"}
+	if len(paths) > 1 {
+		if apiLevel < 21 {
+			return fmt.Errorf("split APKs can not be installed on API level %d, install-multiple requires API level 21", apiLevel)
+		}
+		args[0] = "install-multiple"
+	}
+	if apiLevel >= 23 {
+		args = append(args, "-g")
+	}
+	args = append(args, paths...)
+
+	out, err := adb.command(args...).RunAndReturnTrimmedCombinedOutput()
+	if reason := installFailureReason(out); reason != "" {
+		return fmt.Errorf("install failed: %s", reason)
+	}
+	if err != nil || !strings.Contains(out, "Success") {
+		return fmt.Errorf("install failed, output: %s, error: %v", out, err)
+	}
+	return nil
+}
+
+// installAPKs installs the apps in order, stopping at the first failure.
+func installAPKs(adb adbClient, installs [][]string) ([]apkInstallResult, error) {
+	results := []apkInstallResult{}
+
+	level, err := apiLevel(adb)
+	if err != nil {
+		return results, err
+	}
+
+	for _, paths := range installs {
+		names := []string{}
+		for _, pth := range paths {
+			names = append(names, filepath.Base(pth))
+		}
+		log.Printf("> Installing: %s", strings.Join(names, ", "))
+
+		startTime := time.Now()
+		err := installAPK(adb, paths, level)
+		result := apkInstallResult{Paths: paths, DurationSeconds: time.Since(startTime).Seconds()}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+
+		if err != nil {
+			return results, fmt.Errorf("failed to install %s, %s", strings.Join(names, ", "), err)
+		}
+		log.Donef("> Installed in %.1fs", result.DurationSeconds)
+	}
+	return results, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+func avdConfigPth(name string) string {
+	return filepath.Join(avdImageDir(name), "config.ini")
+}
+
+// readAVDConfig returns the key-value pairs of the AVD's config.ini.
+func readAVDConfig(name string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(avdConfigPth(name))
+	if err != nil {
+		return nil, err
+	}
+
+	config := map[string]string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		split := strings.SplitN(line, "=", 2)
+		if len(split) == 2 {
+			config[strings.TrimSpace(split[0])] = strings.TrimSpace(split[1])
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/hashicorp/go-version"
+)
+
+// avdCacheKey identifies the AVD state by the system image, the emulator version and the AVD configuration,
+// a cached state can only be restored if all of them match.
+func avdCacheKey(androidHome, avdName string, emulatorVersion *version.Version) (string, error) {
+	configContent, err := ioutil.ReadFile(avdConfigPth(avdName))
+	if err != nil {
+		return "", fmt.Errorf("failed to read AVD config, error: %s", err)
+	}
+
+	config, err := readAVDConfig(avdName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read AVD config, error: %s", err)
+	}
+
+	systemImage := config["image.sysdir.1"]
+	systemImageRevision := ""
+	if systemImage != "" {
+		if revision, err := packageRevision(filepath.Join(androidHome, systemImage)); err == nil {
+			systemImageRevision = revision.String()
+		}
+	}
+
+	emulatorVersionStr := ""
+	if emulatorVersion != nil {
+		emulatorVersionStr = emulatorVersion.String()
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "system_image=%s@%s\n", systemImage, systemImageRevision)
+	fmt.Fprintf(hash, "emulator=%s\n", emulatorVersionStr)
+	fmt.Fprintf(hash, "config=%s\n", configContent)
+
+	return hex.EncodeToString(hash.Sum(nil))[:16], nil
+}
+
+func avdCacheArchivePth(cacheDir, avdName, key string) string {
+	return filepath.Join(cacheDir, fmt.Sprintf("avd-%s-%s.tar.gz", avdName, key))
+}
+
+func fileSHA256(pth string) (string, error) {
+	file, err := os.Open(pth)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Warnf("Failed to close file (%s), error: %s", pth, err)
+		}
+	}()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// isAVDCacheIgnored tells whether a file of the AVD dir should be left out of the cache,
+// the lock files belong to the running emulator instance.
+func isAVDCacheIgnored(relPth string) bool {
+	return strings.HasSuffix(relPth, ".lock") || strings.Contains(relPth, ".lock"+string(filepath.Separator))
+}
+
+// writeAVDCacheArchive archives the AVD dir (userdata images and snapshots) into the given path.
+func writeAVDCacheArchive(avdDir, archivePth string) error {
+	file, err := os.Create(archivePth)
+	if err != nil {
+		return err
+	}
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	walkErr := filepath.Walk(avdDir, func(pth string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPth, err := filepath.Rel(avdDir, pth)
+		if err != nil {
+			return err
+		}
+		if relPth == "." || isAVDCacheIgnored(relPth) || !(info.IsDir() || info.Mode().IsRegular()) {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPth)
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		src, err := os.Open(pth)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tarWriter, src)
+		if closeErr := src.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	})
+
+	for _, closer := range []io.Closer{tarWriter, gzipWriter, file} {
+		if err := closer.Close(); err != nil && walkErr == nil {
+			walkErr = err
+		}
+	}
+	return walkErr
+}
+
+// packAVDCache archives the AVD dir and writes its checksum next to it.
+// The emulator has to be stopped, as it keeps writing the images and the snapshots while running.
+// The archive is written to a temporary file and moved into place once it is complete,
+// so an interrupted pack never leaves a truncated archive behind at the cache path.
+func packAVDCache(avdName, archivePth string) error {
+	if err := os.MkdirAll(filepath.Dir(archivePth), 0777); err != nil {
+		return err
+	}
+
+	tmpPth := archivePth + ".tmp"
+	defer func() {
+		// nothing is left to remove once the archive is moved into place
+		if err := os.RemoveAll(tmpPth); err != nil {
+			log.Warnf("Failed to remove %s, error: %s", tmpPth, err)
+		}
+	}()
+
+	if err := writeAVDCacheArchive(avdImageDir(avdName), tmpPth); err != nil {
+		return err
+	}
+
+	checksum, err := fileSHA256(tmpPth)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(archivePth+".sha256", []byte(checksum), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPth, archivePth)
+}
+
+// verifyAVDCache checks the archive against the checksum saved by packAVDCache.
+func verifyAVDCache(archivePth string) error {
+	expected, err := ioutil.ReadFile(archivePth + ".sha256")
+	if err != nil {
+		return fmt.Errorf("failed to read checksum, error: %s", err)
+	}
+
+	actual, err := fileSHA256(archivePth)
+	if err != nil {
+		return fmt.Errorf("failed to calculate checksum, error: %s", err)
+	}
+
+	if strings.TrimSpace(string(expected)) != actual {
+		return fmt.Errorf("checksum mismatch, expected: %s, actual: %s", strings.TrimSpace(string(expected)), actual)
+	}
+	return nil
+}
+
+// extractAVDCache extracts the archive into the given dir, refusing entries pointing outside of it.
+func extractAVDCache(archivePth, dir string) error {
+	file, err := os.Open(archivePth)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Warnf("Failed to close file (%s), error: %s", archivePth, err)
+		}
+	}()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		pth := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(pth, dir+string(filepath.Separator)) {
+			return fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(pth, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+				return err
+			}
+
+			dst, err := os.OpenFile(pth, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode))
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(dst, tarReader)
+			if closeErr := dst.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// restoreAVDCache replaces the AVD dir with the archived one.
+// The archive is extracted next to the AVD dir first, so the AVD is left untouched if the extraction fails.
+func restoreAVDCache(avdName, archivePth string) error {
+	avdDir := avdImageDir(avdName)
+	restoreDir := avdDir + ".restore"
+	backupDir := avdDir + ".backup"
+
+	for _, dir := range []string{restoreDir, backupDir} {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+
+	if err := extractAVDCache(archivePth, restoreDir); err != nil {
+		if removeErr := os.RemoveAll(restoreDir); removeErr != nil {
+			log.Warnf("Failed to remove %s, error: %s", restoreDir, removeErr)
+		}
+		return err
+	}
+
+	if err := os.Rename(avdDir, backupDir); err != nil {
+		return err
+	}
+	if err := os.Rename(restoreDir, avdDir); err != nil {
+		if restoreErr := os.Rename(backupDir, avdDir); restoreErr != nil {
+			log.Warnf("Failed to move back the original AVD dir from %s, error: %s", backupDir, restoreErr)
+		}
+		return err
+	}
+
+	if err := os.RemoveAll(backupDir); err != nil {
+		log.Warnf("Failed to remove %s, error: %s", backupDir, err)
+	}
+	return nil
+}
+
+// relaunchEmulatorOptions returns the options to start the emulator again after its state was cached:
+// the data is not wiped again and the state saved at the exit is loaded.
+func relaunchEmulatorOptions(options []string) []string {
+	relaunchOptions := []string{}
+	for i, option := range options {
+		if option == "-qemu" {
+			return append(relaunchOptions, options[i:]...)
+		}
+		if option == "-wipe-data" || option == "-no-snapshot-load" {
+			continue
+		}
+		relaunchOptions = append(relaunchOptions, option)
+	}
+	return relaunchOptions
+}
+
+// removeStaleAVDCaches deletes the archives of the AVD cached with a different key.
+func removeStaleAVDCaches(cacheDir, avdName, archivePth string) {
+	pattern := filepath.Join(cacheDir, fmt.Sprintf("avd-%s-*.tar.gz", avdName))
+	archives, err := filepath.Glob(pattern)
+	if err != nil {
+		log.Warnf("Failed to list cached AVD archives, error: %s", err)
+		return
+	}
+
+	for _, archive := range archives {
+		if archive == archivePth {
+			continue
+		}
+		for _, pth := range []string{archive, archive + ".sha256"} {
+			if err := os.RemoveAll(pth); err != nil {
+				log.Warnf("Failed to remove stale AVD cache (%s), error: %s", pth, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestArchive(t *testing.T, pth string, names []string) {
+	file, err := os.Create(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, name := range names {
+		content := []byte("content of " + name)
+		if err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractAVDCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		wantErr bool
+	}{
+		{
+			name:    "entries inside the dir",
+			entries: []string{"config.ini", "snapshots/default_boot/ram.bin", "./userdata-qemu.img"},
+		},
+		{
+			name:    "absolute entry is extracted into the dir",
+			entries: []string{"/config.ini"},
+		},
+		{
+			name:    "parent dir",
+			entries: []string{"../escaped"},
+			wantErr: true,
+		},
+		{
+			name:    "parent dir inside the path",
+			entries: []string{"snapshots/../../escaped"},
+			wantErr: true,
+		},
+		{
+			name:    "sibling dir with the same prefix",
+			entries: []string{"../avd-sibling/escaped"},
+			wantErr: true,
+		},
+		{
+			name:    "the dir itself",
+			entries: []string{"."},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			archivePth := filepath.Join(tmpDir, "cache.tar.gz")
+			dir := filepath.Join(tmpDir, "avd")
+			writeTestArchive(t, archivePth, tt.entries)
+
+			err := extractAVDCache(archivePth, dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractAVDCache() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			escaped, err := filepath.Glob(filepath.Join(tmpDir, "*", "escaped"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(filepath.Join(tmpDir, "escaped")); err == nil {
+				escaped = append(escaped, filepath.Join(tmpDir, "escaped"))
+			}
+			if len(escaped) > 0 {
+				t.Errorf("extractAVDCache() wrote outside of the dir: %v", escaped)
+			}
+
+			if tt.wantErr {
+				return
+			}
+			for _, entry := range tt.entries {
+				content, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(entry)))
+				if err != nil {
+					t.Fatalf("extractAVDCache() did not extract %s, error: %s", entry, err)
+				}
+				if string(content) != "content of "+entry {
+					t.Errorf("extractAVDCache() extracted %s with content %q", entry, content)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	caCertificateStoreUser   = "user"
+	caCertificateStoreSystem = "system"
+
+	userCACertificatesDir   = "/data/misc/user/0/cacerts-added"
+	systemCACertificatesDir = "/system/etc/security/cacerts"
+)
+
+var caCertificateStores = []string{caCertificateStoreUser, caCertificateStoreSystem}
+
+// readCACertificate reads a PEM or DER encoded certificate and returns it in PEM format.
+func readCACertificate(pth string) (*x509.Certificate, []byte, error) {
+	content, err := ioutil.ReadFile(pth)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	der := content
+	if block, _ := pem.Decode(content); block != nil {
+		der = block.Bytes
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse certificate (%s), error: %s", pth, err)
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), nil
+}
+
+// caCertificateFileName returns the name Android looks up the certificate by: <subject_hash_old>.0,
+// subject_hash_old is the first 4 bytes of the MD5 hash of the DER encoded subject, read as a little-endian number.
+func caCertificateFileName(cert *x509.Certificate) string {
+	hash := md5.Sum(cert.RawSubject)
+	return fmt.Sprintf("%08x.0", binary.LittleEndian.Uint32(hash[:4]))
+}
+
+// remountSystem remounts the system partition as writable, the emulator needs to be started with -writable-system.
+func remountSystem(adb adbClient) error {
+	if err := rootADB(adb); err != nil {
+		return err
+	}
+
+	out, err := adb.command("remount").RunAndReturnTrimmedCombinedOutput()
+	if err != nil || !strings.Contains(strings.ToLower(out), "remount succeeded") {
+		return fmt.Errorf("failed to remount system partition (make sure the emulator is started with -writable-system), output: %s, error: %v", out, err)
+	}
+	return nil
+}
+
+// installCACertificates installs the certificates into the user or system certificate store of the device.
+// Installing into either store requires an emulator image with root access.
+func installCACertificates(adb adbClient, pths []string, store string) error {
+	level, err := apiLevel(adb)
+	if err != nil {
+		return err
+	}
+
+	dir := userCACertificatesDir
+	if store == caCertificateStoreSystem {
+		if level >= 34 {
+			log.Warnf("System certificates are loaded from the Conscrypt APEX on API level %d, the installed certificates may not be trusted", level)
+		}
+
+		if err := remountSystem(adb); err != nil {
+			return err
+		}
+		dir = systemCACertificatesDir
+	} else if err := rootADB(adb); err != nil {
+		return err
+	}
+
+	if out, err := adb.shell("mkdir", "-p", dir); err != nil {
+		return fmt.Errorf("failed to create %s, output: %s, error: %s", dir, out, err)
+	}
+
+	tmpDir, err := ioutil.TempDir("", "cacerts")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir, error: %s", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			log.Warnf("Failed to remove temp dir (%s), error: %s", tmpDir, err)
+		}
+	}()
+
+	for _, pth := range pths {
+		cert, content, err := readCACertificate(pth)
+		if err != nil {
+			return err
+		}
+
+		name := caCertificateFileName(cert)
+		devicePth := dir + "/" + name
+		log.Printf("> Installing %s (%s) as %s", pth, cert.Subject.CommonName, devicePth)
+
+		localPth := filepath.Join(tmpDir, name)
+		if err := ioutil.WriteFile(localPth, content, 0644); err != nil {
+			return fmt.Errorf("failed to write certificate (%s), error: %s", localPth, err)
+		}
+
+		if err := pushFile(adb, localPth, devicePth, level); err != nil {
+			return err
+		}
+		if out, err := adb.shell("chmod", "644", devicePth); err != nil {
+			return fmt.Errorf("failed to set permissions of %s, output: %s, error: %s", devicePth, out, err)
+		}
+		if store == caCertificateStoreUser {
+			if out, err := adb.shell("chown", "system:system", devicePth); err != nil {
+				return fmt.Errorf("failed to set owner of %s, output: %s, error: %s", devicePth, out, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// testCACertificate is a self-signed certificate with subject: C=US, O=Example Org, CN=Example Test CA,
+// its subject_hash_old (openssl x509 -noout -subject_hash_old) is 894d1327.
+const testCACertificate = `-----BEGIN CERTIFICATE-----
+MIIB0DCCAXegAwIBAgIUOEV+E6nItKH0YmNItQkP8FZ5dTowCgYIKoZIzj0EAwIw
+PTELMAkGA1UEBhMCVVMxFDASBgNVBAoMC0V4YW1wbGUgT3JnMRgwFgYDVQQDDA9F
+eGFtcGxlIFRlc3QgQ0EwIBcNMjYxMDE5MTAyOTUzWhgPMjEyNjA5MjUxMDI5NTNa
+MD0xCzAJBgNVBAYTAlVTMRQwEgYDVQQKDAtFeGFtcGxlIE9yZzEYMBYGA1UEAwwP
+RXhhbXBsZSBUZXN0IENBMFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAElWEjosiY
+vVBT0bP+TG6qzjTc9oOxW9I8gfPefT8DTuNC5eRRNuITbU/g3LmwjtbYgsH0TXD0
+Us/F1ijqH/B6iqNTMFEwHQYDVR0OBBYEFO7Q4kKCzLPSY5Eo3ihzUYVsEwRHMB8G
+A1UdIwQYMBaAFO7Q4kKCzLPSY5Eo3ihzUYVsEwRHMA8GA1UdEwEB/wQFMAMBAf8w
+CgYIKoZIzj0EAwIDRwAwRAIgGHhqEqSsMuMk8rOavT2am7bbaGbOpiid34H+WWLg
+vgECIEiNHGb8OCSmnaOqFREUnUJKXzaTXXGaSJaqFTJkwAOj
+-----END CERTIFICATE-----
+`
+
+func TestCACertificateFileName(t *testing.T) {
+	block, _ := pem.Decode([]byte(testCACertificate))
+	if block == nil {
+		t.Fatal("failed to decode test certificate")
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{
+			name:    "PEM encoded",
+			content: []byte(testCACertificate),
+			want:    "894d1327.0",
+		},
+		{
+			name:    "DER encoded",
+			content: block.Bytes,
+			want:    "894d1327.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pth := filepath.Join(t.TempDir(), "ca.crt")
+			if err := ioutil.WriteFile(pth, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cert, _, err := readCACertificate(pth)
+			if err != nil {
+				t.Fatalf("readCACertificate() error = %v", err)
+			}
+			if got := caCertificateFileName(cert); got != tt.want {
+				t.Errorf("caCertificateFileName() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func wipeDataInputOption() inputOption {
+	return inputOption{args: []string{"-wipe-data"}, overriddenBy: []string{"-wipe-data"}}
+}
+
+// thirdPartyPackages returns the packages installed by the user, a clean device has none.
+func thirdPartyPackages(adb adbClient) ([]string, error) {
+	out, err := adb.shell("pm", "list", "packages", "-3")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packages, output: %s, error: %s", out, err)
+	}
+
+	packages := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "package:") {
+			packages = append(packages, strings.TrimPrefix(line, "package:"))
+		}
+	}
+	return packages, nil
+}
+
+func verifyCleanState(adb adbClient) error {
+	packages, err := thirdPartyPackages(adb)
+	if err != nil {
+		return err
+	}
+	if len(packages) > 0 {
+		return fmt.Errorf("device is not clean, third-party packages are installed: %s", strings.Join(packages, ", "))
+	}
+	return nil
+}
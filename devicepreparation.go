@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// deviceSetting is a value of the Android settings provider (adb shell settings put <namespace> <key> <value>).
+type deviceSetting struct {
+	namespace string
+	key       string
+	value     string
+}
+
+var (
+	disableAnimationsSettings = []deviceSetting{
+		{namespace: "global", key: "window_animation_scale", value: "0"},
+		{namespace: "global", key: "transition_animation_scale", value: "0"},
+		{namespace: "global", key: "animator_duration_scale", value: "0"},
+	}
+	// 7 = BatteryManager.BATTERY_PLUGGED_AC | BATTERY_PLUGGED_USB | BATTERY_PLUGGED_WIRELESS
+	stayAwakeSettings = []deviceSetting{
+		{namespace: "global", key: "stay_on_while_plugged_in", value: "7"},
+	}
+	disableScreenTimeoutSettings = []deviceSetting{
+		{namespace: "system", key: "screen_off_timeout", value: "2147483647"},
+	}
+	hideSoftKeyboardSettings = []deviceSetting{
+		{namespace: "secure", key: "show_ime_with_hard_keyboard", value: "0"},
+	}
+	disableImmersiveModeConfirmationSettings = []deviceSetting{
+		{namespace: "secure", key: "immersive_mode_confirmations", value: "confirmed"},
+	}
+	disableErrorDialogsSettings = []deviceSetting{
+		{namespace: "global", key: "hide_error_dialogs", value: "1"},
+	}
+)
+
+// devicePreparationSettings returns the settings to apply after the boot based on the inputs.
+func devicePreparationSettings(configs ConfigsModel) []deviceSetting {
+	settings := []deviceSetting{}
+	if configs.DisableAnimations == "true" {
+		settings = append(settings, disableAnimationsSettings...)
+	}
+	if configs.StayAwake == "true" {
+		settings = append(settings, stayAwakeSettings...)
+	}
+	if configs.DisableScreenTimeout == "true" {
+		settings = append(settings, disableScreenTimeoutSettings...)
+	}
+	if configs.HideSoftKeyboard == "true" {
+		settings = append(settings, hideSoftKeyboardSettings...)
+	}
+	if configs.DisableImmersiveModeConfirmation == "true" {
+		settings = append(settings, disableImmersiveModeConfirmationSettings...)
+	}
+	if configs.DisableErrorDialogs == "true" {
+		settings = append(settings, disableErrorDialogsSettings...)
+	}
+	return settings
+}
+
+// applyDeviceSettings puts the settings and reads them back to verify they were applied.
+func applyDeviceSettings(adb adbClient, settings []deviceSetting) error {
+	for _, setting := range settings {
+		log.Printf("> settings put %s %s %s", setting.namespace, setting.key, setting.value)
+
+		if out, err := adb.shell("settings", "put", setting.namespace, setting.key, setting.value); err != nil {
+			return fmt.Errorf("failed to set %s, output: %s, error: %s", setting.key, out, err)
+		}
+
+		out, err := adb.shell("settings", "get", setting.namespace, setting.key)
+		if err != nil {
+			return fmt.Errorf("failed to get %s, output: %s, error: %s", setting.key, out, err)
+		}
+		if strings.TrimSpace(out) != setting.value {
+			return fmt.Errorf("failed to set %s, expected: %s, actual: %s", setting.key, setting.value, out)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	diskSpacePolicyWarn = "warn"
+	diskSpacePolicyFail = "fail"
+)
+
+var sizeRegexp = regexp.MustCompile(`(?i)^(\d+)\s*([KMGT]?)B?$`)
+
+// parseSize parses the sizes used in the AVD config, like 2G, 800M or 2147483648.
+func parseSize(value string) (int64, error) {
+	matches := sizeRegexp.FindStringSubmatch(strings.TrimSpace(value))
+	if len(matches) != 3 {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+
+	size, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	switch strings.ToUpper(matches[2]) {
+	case "K":
+		size *= 1024
+	case "M":
+		size *= 1024 * 1024
+	case "G":
+		size *= 1024 * 1024 * 1024
+	case "T":
+		size *= 1024 * 1024 * 1024 * 1024
+	}
+	return size, nil
+}
+
+// avdFootprint estimates the disk space used by the AVD once it is booted and saved:
+// the data partition, the sdcard and a snapshot (roughly the size of the RAM).
+func avdFootprint(config map[string]string) (int64, error) {
+	footprint := int64(0)
+	for _, key := range []string{"disk.dataPartition.size", "sdcard.size"} {
+		if value, ok := config[key]; ok && value != "" {
+			size, err := parseSize(value)
+			if err != nil {
+				return 0, fmt.Errorf("invalid %s, error: %s", key, err)
+			}
+			footprint += size
+		}
+	}
+
+	snapshotSize, err := ramSize(config)
+	if err != nil {
+		return 0, err
+	}
+	return footprint + snapshotSize, nil
+}
+
+// ramSize returns the AVD's RAM size (hw.ramSize is in megabytes unless it has a unit).
+func ramSize(config map[string]string) (int64, error) {
+	value, ok := config["hw.ramSize"]
+	if !ok || value == "" {
+		return 0, nil
+	}
+
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		value += "M"
+	}
+	size, err := parseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hw.ramSize, error: %s", err)
+	}
+	return size, nil
+}
+
+func freeDiskSpace(pth string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(pth, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
+
+// checkDiskSpace returns the issues found comparing the AVD's expected footprint with the free space
+// on the AVD's volume and in the temp dir.
+func checkDiskSpace(avdName string) ([]string, error) {
+	config, err := readAVDConfig(avdName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AVD config, error: %s", err)
+	}
+
+	footprint, err := avdFootprint(config)
+	if err != nil {
+		return nil, err
+	}
+
+	used, err := dirSize(avdImageDir(avdName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate AVD size, error: %s", err)
+	}
+
+	required := footprint - used
+	if required < 0 {
+		required = 0
+	}
+
+	issues := []string{}
+
+	avdFree, err := freeDiskSpace(avdImageDir(avdName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get free disk space of the AVD volume, error: %s", err)
+	}
+	if avdFree < required {
+		issues = append(issues, fmt.Sprintf("the AVD needs %s more disk space, but only %s is available at: %s", formatSize(required), formatSize(avdFree), avdImageDir(avdName)))
+	}
+
+	ram, err := ramSize(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpFree, err := freeDiskSpace(os.TempDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get free disk space of the temp dir, error: %s", err)
+	}
+	if tmpFree < ram {
+		issues = append(issues, fmt.Sprintf("the emulator may need %s in the temp dir, but only %s is available at: %s", formatSize(ram), formatSize(tmpFree), os.TempDir()))
+	}
+
+	return issues, nil
+}
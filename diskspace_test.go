@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "2147483648", want: 2147483648},
+		{value: "512 MB", want: 512 * 1024 * 1024},
+		{value: "512MB", want: 512 * 1024 * 1024},
+		{value: "800M", want: 800 * 1024 * 1024},
+		{value: "2G", want: 2 * 1024 * 1024 * 1024},
+		{value: "2g", want: 2 * 1024 * 1024 * 1024},
+		{value: "64K", want: 64 * 1024},
+		{value: "1T", want: 1024 * 1024 * 1024 * 1024},
+		{value: " 2G ", want: 2 * 1024 * 1024 * 1024},
+		{value: "", wantErr: true},
+		{value: "G", wantErr: true},
+		{value: "1.5G", wantErr: true},
+		{value: "2 GiB", wantErr: true},
+		{value: "-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseSize(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSize(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSize(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const outputTailSize = 20
+
+// outputPattern describes a known emulator output line and how to resolve it.
+type outputPattern struct {
+	regexp      *regexp.Regexp
+	explanation string
+	hint        string
+}
+
+// fatalOutputPatterns lists the emulator output lines after which the emulator will never boot.
+var fatalOutputPatterns = []outputPattern{
+	{
+		regexp:      regexp.MustCompile(`PANIC: Missing emulator engine program for '(.*)' CPU`),
+		explanation: "The installed emulator package does not contain an engine for the AVD's CPU architecture.",
+		hint:        "Update the emulator package (sdkmanager \"emulator\") or create the AVD with an ABI supported on this host.",
+	},
+	{
+		regexp:      regexp.MustCompile(`(PANIC|ERROR): (Cannot find|Broken) AVD system path`),
+		explanation: "The system image referenced by the AVD is not installed.",
+		hint:        "Install the system image with sdkmanager and make sure ANDROID_HOME points to the SDK it was installed into.",
+	},
+	{
+		regexp:      regexp.MustCompile(`PANIC: Unknown AVD name`),
+		explanation: "The emulator could not find the AVD.",
+		hint:        "Check the emulator_name input and that the AVD was created for the current user.",
+	},
+	{
+		regexp:      regexp.MustCompile(`x86(_64)? emulation currently requires hardware acceleration`),
+		explanation: "x86 system images can not run without hardware acceleration on this host.",
+		hint:        "Enable KVM (Linux) or HAXM (macOS), or use an ARM system image.",
+	},
+	{
+		regexp:      regexp.MustCompile(`qemu-system-.*: failed to initialize (HAX|KVM)`),
+		explanation: "The emulator engine failed to initialize hardware acceleration.",
+		hint:        "Make sure /dev/kvm (Linux) or HAXM (macOS) is available to the current user, or start the emulator with -no-accel.",
+	},
+	{
+		regexp:      regexp.MustCompile(`/dev/kvm.*(not found|permission denied|Permission denied)`),
+		explanation: "The KVM device is missing or not accessible by the current user.",
+		hint:        "Add the current user to the kvm group or start the emulator with -no-accel.",
+	},
+}
+
+// fatalOutputError is returned when the emulator prints a line matching one of the fatalOutputPatterns.
+type fatalOutputError struct {
+	line    string
+	pattern outputPattern
+}
+
+func (err fatalOutputError) Error() string {
+	return fmt.Sprintf("emulator reported a fatal error: %s", err.line)
+}
+
+func classifyOutputLine(line string) *outputPattern {
+	for _, pattern := range fatalOutputPatterns {
+		if pattern.regexp.MatchString(line) {
+			return &pattern
+		}
+	}
+	return nil
+}
+
+// earlyExitError is returned when the emulator process exits before the boot completes.
+type earlyExitError struct {
+	exitCode int
+	elapsed  time.Duration
+	tail     []string
+}
+
+func (err earlyExitError) Error() string {
+	return fmt.Sprintf("emulator exited with code %d after %.1fs", err.exitCode, err.elapsed.Seconds())
+}
+
+// outputTail keeps the last lines of the emulator output.
+type outputTail struct {
+	mutex sync.Mutex
+	size  int
+	lines []string
+}
+
+func newOutputTail(size int) *outputTail {
+	return &outputTail{size: size}
+}
+
+func (tail *outputTail) add(line string) {
+	tail.mutex.Lock()
+	defer tail.mutex.Unlock()
+
+	tail.lines = append(tail.lines, line)
+	if len(tail.lines) > tail.size {
+		tail.lines = tail.lines[len(tail.lines)-tail.size:]
+	}
+}
+
+func (tail *outputTail) get() []string {
+	tail.mutex.Lock()
+	defer tail.mutex.Unlock()
+
+	return append([]string{}, tail.lines...)
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/bitrise-tools/go-android/adbmanager"
+	"github.com/bitrise-tools/go-android/emulatormanager"
+	"github.com/hashicorp/go-version"
+)
+
+const emulatorStopTimeout = 5 * time.Minute
+
+// classicEngineRemovedVersion is the first emulator version without the classic engines (emulator64-<arch>).
+const classicEngineRemovedVersion = "28.0.0"
+
+// classicEngineArchs maps the AVD ABIs to the suffix of the classic emulator engines (emulator64-<arch>).
+var classicEngineArchs = map[string]string{
+	"armeabi":     "arm",
+	"armeabi-v7a": "arm",
+	"x86":         "x86",
+	"x86_64":      "x86",
+	"mips":        "mips",
+}
+
+// qemuArchs maps the AVD ABIs to the suffixes of the QEMU2 engines (qemu-system-<arch>) able to run them.
+var qemuArchs = map[string][]string{
+	"armeabi":     {"armel"},
+	"armeabi-v7a": {"armel"},
+	"arm64-v8a":   {"aarch64"},
+	"x86":         {"i386", "x86_64"},
+	"x86_64":      {"x86_64"},
+	"mips":        {"mipsel"},
+	"mips64":      {"mips64el"},
+}
+
+// emulatorTool runs the emulator binary of the SDK.
+// It mirrors emulatormanager.Model, which does not expose the binary and the environment it runs the emulator with.
+type emulatorTool struct {
+	binPth string
+	envs   []string
+	legacy bool
+}
+
+// emulatorLibEnv returns the library path env required by the emulator, like emulatormanager does.
+func emulatorLibEnv(emulatorDir string, legacy bool) (string, error) {
+	envKey := ""
+	switch runtime.GOOS {
+	case "linux":
+		envKey = "LD_LIBRARY_PATH"
+	case "darwin":
+		envKey = "DYLD_LIBRARY_PATH"
+	default:
+		return "", fmt.Errorf("unsupported os %s", runtime.GOOS)
+	}
+
+	libPth := filepath.Join(emulatorDir, "lib64")
+	if legacy {
+		if exist, err := pathutil.IsPathExists(libPth); err != nil {
+			return "", err
+		} else if !exist {
+			return "", fmt.Errorf("lib64 does not exist at: %s", libPth)
+		}
+		return envKey + "=" + libPth, nil
+	}
+
+	qtLibPth := filepath.Join(libPth, "qt", "lib")
+	if exist, err := pathutil.IsPathExists(qtLibPth); err != nil {
+		return "", err
+	} else if !exist {
+		return "", fmt.Errorf("qt lib does not exist at: %s", qtLibPth)
+	}
+	return envKey + "=" + libPth + ":" + qtLibPth, nil
+}
+
+func newEmulatorTool(androidHome string) (*emulatorTool, error) {
+	legacy, err := emulatormanager.IsLegacyEmulator(androidHome)
+	if err != nil {
+		return nil, err
+	}
+
+	emulatorDir := filepath.Join(androidHome, "emulator")
+	if legacy {
+		emulatorDir = filepath.Join(androidHome, "tools")
+	}
+
+	binPth := filepath.Join(emulatorDir, "emulator")
+	if exist, err := pathutil.IsPathExists(binPth); err != nil {
+		return nil, err
+	} else if !exist {
+		return nil, fmt.Errorf("no emulator binary found in: %s", emulatorDir)
+	}
+
+	envs := []string{}
+	if env, err := emulatorLibEnv(emulatorDir, legacy); err != nil {
+		log.Warnf("Failed to get lib64 qt lib path, error: %s", err)
+	} else {
+		envs = append(envs, env)
+	}
+	if legacy {
+		envs = append(envs, "SHELL=/bin/bash")
+	}
+
+	return &emulatorTool{binPth: binPth, envs: envs, legacy: legacy}, nil
+}
+
+func (tool emulatorTool) command(args ...string) *command.Model {
+	return command.New(tool.binPth, args...).AppendEnvs(tool.envs...)
+}
+
+// Version returns the version of the emulator package, based on its source.properties
+// or on the output of `emulator -version` if the properties file is not available.
+func (tool emulatorTool) Version() (*version.Version, error) {
+	if revision, err := packageRevision(filepath.Dir(tool.binPth)); err == nil {
+		return revision, nil
+	}
+
+	cmd := tool.command("-version")
+	out, err := cmd.RunAndReturnTrimmedCombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed, output: %s, error: %s", cmd.PrintableCommandArgs(), out, err)
+	}
+
+	// Android emulator version 27.1.12.0 (build_id 4780423) (CL:N/A)
+	matches := regexp.MustCompile(`emulator version (\d+(\.\d+)*)`).FindStringSubmatch(out)
+	if len(matches) < 2 {
+		return nil, fmt.Errorf("failed to parse emulator version from: %s", out)
+	}
+	return version.NewVersion(matches[1])
+}
+
+// Help returns the output of `emulator -help`.
+func (tool emulatorTool) Help() (string, error) {
+	cmd := tool.command("-help")
+	out, err := cmd.RunAndReturnTrimmedCombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s failed, output: %s, error: %s", cmd.PrintableCommandArgs(), out, err)
+	}
+	return out, nil
+}
+
+// AccelCheck returns the output of `emulator -accel-check`, the command exits with non-zero status if the acceleration is not usable,
+// so its output is returned even if it fails.
+func (tool emulatorTool) AccelCheck() (string, error) {
+	return tool.command("-accel-check").RunAndReturnTrimmedCombinedOutput()
+}
+
+// qemuEnginePths returns the QEMU2 engines of the unified emulator able to run the ABI,
+// for every host architecture the emulator package ships engines for (qemu/<os>-x86_64, qemu/<os>-aarch64).
+func (tool emulatorTool) qemuEnginePths(abi string) ([]string, error) {
+	hostDirs, err := filepath.Glob(filepath.Join(filepath.Dir(tool.binPth), "qemu", runtime.GOOS+"-*"))
+	if err != nil {
+		return nil, err
+	}
+
+	pths := []string{}
+	for _, hostDir := range hostDirs {
+		for _, arch := range qemuArchs[abi] {
+			pths = append(pths, filepath.Join(hostDir, "qemu-system-"+arch))
+		}
+	}
+	return pths, nil
+}
+
+// emulatorBinPth returns the emulator binary able to run the given ABI.
+//
+// The unified emulator (in $ANDROID_HOME/emulator) dispatches to the right engine itself,
+// so only the existence of a compatible engine is checked: a QEMU2 engine,
+// or a classic engine (emulator64-<arch>) on emulators older than classicEngineRemovedVersion.
+// The legacy emulator (in $ANDROID_HOME/tools) is started with its launcher,
+// except for ARM AVDs on Linux, which need the classic ARM engine.
+func (tool emulatorTool) emulatorBinPth(abi string, emulatorVersion *version.Version) (string, error) {
+	emulatorDir := filepath.Dir(tool.binPth)
+
+	classicEnginePth := ""
+	if arch, ok := classicEngineArchs[abi]; ok && (emulatorVersion == nil || !versionAtLeast(emulatorVersion, classicEngineRemovedVersion)) {
+		classicEnginePth = filepath.Join(emulatorDir, "emulator64-"+arch)
+	}
+
+	if tool.legacy {
+		if classicEngineArchs[abi] == "arm" && runtime.GOOS != "darwin" {
+			if exist, err := pathutil.IsPathExists(classicEnginePth); err != nil {
+				return "", err
+			} else if exist {
+				return classicEnginePth, nil
+			}
+			log.Warnf("Emulator binary does not exist at: %s", classicEnginePth)
+		}
+		return tool.binPth, nil
+	}
+
+	enginePths, err := tool.qemuEnginePths(abi)
+	if err != nil {
+		return "", err
+	}
+	if classicEnginePth != "" {
+		enginePths = append(enginePths, classicEnginePth)
+	}
+	if len(enginePths) == 0 {
+		return "", fmt.Errorf("no emulator engine available for the %s ABI on this host (%s)", abi, runtime.GOOS)
+	}
+
+	for _, enginePth := range enginePths {
+		if exist, err := pathutil.IsPathExists(enginePth); err != nil {
+			return "", err
+		} else if exist {
+			return tool.binPth, nil
+		}
+	}
+	return "", fmt.Errorf("no emulator engine found for the %s ABI, checked: %s", abi, strings.Join(enginePths, ", "))
+}
+
+// StartEmulatorCommand returns the command starting the AVD with the emulator binary able to run its ABI.
+func (tool emulatorTool) StartEmulatorCommand(name, skin string, emulatorVersion *version.Version, options ...string) (*command.Model, error) {
+	config, err := readAVDConfig(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AVD config, error: %s", err)
+	}
+	abi := config["abi.type"]
+	if abi == "" {
+		return nil, fmt.Errorf("no abi.type found in: %s", avdConfigPth(name))
+	}
+
+	binPth, err := tool.emulatorBinPth(abi, emulatorVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"-avd", name}
+	if len(skin) == 0 {
+		args = append(args, "-noskin")
+	} else {
+		args = append(args, "-skin", skin)
+	}
+	args = append(args, options...)
+
+	return command.New(binPth, args...).AppendEnvs(tool.envs...), nil
+}
+
+// packageRevision returns the revision (Pkg.Revision) of the sdk package installed into the given dir,
+// based on the package's source.properties file.
+func packageRevision(packageDir string) (*version.Version, error) {
+	pth := filepath.Join(packageDir, "source.properties")
+	content, err := ioutil.ReadFile(pth)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		split := strings.SplitN(line, "=", 2)
+		if len(split) == 2 && strings.TrimSpace(split[0]) == "Pkg.Revision" {
+			return version.NewVersion(strings.TrimSpace(split[1]))
+		}
+	}
+	return nil, fmt.Errorf("no Pkg.Revision found in: %s", pth)
+}
+
+// emulatorBoot is a booted emulator instance.
+type emulatorBoot struct {
+	cmd            *exec.Cmd
+	serial         string
+	snapshotStatus *snapshotLoadStatus
+	// exited is closed once the emulator process exits
+	exited <-chan struct{}
+}
+
+// stopEmulator stops the emulator through its console (saving the quick boot snapshot, unless disabled)
+// and waits until the process exits and the device leaves the device list.
+// If the emulator does not stop in time it is killed and an error is returned, as its state may be inconsistent.
+func stopEmulator(device adbClient, boot emulatorBoot, adb adbmanager.Model) error {
+	deadline := time.After(emulatorStopTimeout)
+
+	if out, err := device.command("emu", "kill").RunAndReturnTrimmedCombinedOutput(); err != nil {
+		if err := boot.cmd.Process.Kill(); err != nil {
+			log.Warnf("Failed to kill emulator command, error: %s", err)
+		}
+		<-boot.exited
+		return fmt.Errorf("emu kill failed, output: %s, error: %s", out, err)
+	}
+
+	select {
+	case <-boot.exited:
+	case <-deadline:
+		if err := boot.cmd.Process.Kill(); err != nil {
+			log.Warnf("Failed to kill emulator command, error: %s", err)
+		}
+		<-boot.exited
+		return fmt.Errorf("emulator did not exit in %.0fs", emulatorStopTimeout.Seconds())
+	}
+
+	for {
+		deviceStateMap, err := runningDeviceInfos(adb)
+		if err != nil {
+			return err
+		}
+		if _, found := deviceStateMap[boot.serial]; !found {
+			return nil
+		}
+
+		select {
+		case <-deadline:
+			return fmt.Errorf("device (%s) did not leave the device list in %.0fs", boot.serial, emulatorStopTimeout.Seconds())
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/kballard/go-shellquote"
+)
+
+// mediaExtensions lists the file extensions indexed by the media scanner.
+var mediaExtensions = []string{
+	".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp", ".heic",
+	".mp4", ".3gp", ".mkv", ".webm",
+	".mp3", ".m4a", ".aac", ".ogg", ".wav", ".flac",
+}
+
+// listedFileSizeRegexp matches the size column of `ls -l`, followed by the date, in both the toolbox and the toybox format:
+// -rw-r--r-- root     root         1234 2018-01-01 00:00 hosts
+// -rw-r--r-- 1 root root 1234 2018-01-01 00:00 /system/etc/hosts
+var listedFileSizeRegexp = regexp.MustCompile(`\s(\d+)\s+\d{4}-\d{2}-\d{2}\s`)
+
+// filePush is a local file or directory to push onto the device.
+type filePush struct {
+	localPth  string
+	devicePth string
+}
+
+// parsePushFiles parses the push_files input: one local_path:device_path mapping per line.
+func parsePushFiles(value string) ([]filePush, error) {
+	pushes := []filePush{}
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		split := strings.SplitN(line, ":", 2)
+		if len(split) != 2 || strings.TrimSpace(split[0]) == "" || !strings.HasPrefix(strings.TrimSpace(split[1]), "/") {
+			return nil, fmt.Errorf("invalid file mapping, should be local_path:/device/path: %s", line)
+		}
+		pushes = append(pushes, filePush{localPth: strings.TrimSpace(split[0]), devicePth: strings.TrimSpace(split[1])})
+	}
+	return pushes, nil
+}
+
+// pushedFiles lists the local files of the push with their device paths,
+// the files of a directory are placed under the device path keeping their relative path.
+func pushedFiles(push filePush) (map[string]string, error) {
+	info, err := os.Stat(push.localPth)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return map[string]string{push.localPth: push.devicePth}, nil
+	}
+
+	files := map[string]string{}
+	err = filepath.Walk(push.localPth, func(pth string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(push.localPth, pth)
+		if err != nil {
+			return err
+		}
+		files[pth] = path.Join(push.devicePth, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+func fileMD5(pth string) (string, error) {
+	file, err := os.Open(pth)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Warnf("Failed to close file (%s), error: %s", pth, err)
+		}
+	}()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func isMediaFile(pth string) bool {
+	ext := strings.ToLower(path.Ext(pth))
+	for _, mediaExt := range mediaExtensions {
+		if ext == mediaExt {
+			return true
+		}
+	}
+	return false
+}
+
+// parseListedFileSize returns the file size from the `ls -l` output of a single file.
+func parseListedFileSize(out string) (int64, error) {
+	matches := listedFileSizeRegexp.FindStringSubmatch(out)
+	if len(matches) != 2 {
+		return 0, fmt.Errorf("failed to parse file size from: %s", out)
+	}
+	return strconv.ParseInt(matches[1], 10, 64)
+}
+
+// verifyPushedFile compares the checksum of the file on the device with the local one.
+// Below API level 23 the device has no md5sum (toolbox), so only the sizes are compared.
+func verifyPushedFile(adb adbClient, localPth, devicePth string, apiLevel int) error {
+	if apiLevel < 23 {
+		info, err := os.Stat(localPth)
+		if err != nil {
+			return err
+		}
+
+		out, err := adb.shell(shellquote.Join("ls", "-l", devicePth))
+		if err != nil {
+			return fmt.Errorf("failed to list %s on the device, output: %s, error: %s", devicePth, out, err)
+		}
+		size, err := parseListedFileSize(out)
+		if err != nil {
+			return err
+		}
+		if size != info.Size() {
+			return fmt.Errorf("size mismatch of %s, expected: %d, actual: %d", devicePth, info.Size(), size)
+		}
+		return nil
+	}
+
+	localMD5, err := fileMD5(localPth)
+	if err != nil {
+		return fmt.Errorf("failed to calculate checksum of %s, error: %s", localPth, err)
+	}
+
+	out, err := adb.shell(shellquote.Join("md5sum", devicePth))
+	if err != nil {
+		return fmt.Errorf("failed to calculate checksum of %s on the device, output: %s, error: %s", devicePth, out, err)
+	}
+	if fields := strings.Fields(out); len(fields) == 0 || fields[0] != localMD5 {
+		return fmt.Errorf("checksum mismatch of %s, expected: %s, actual: %s", devicePth, localMD5, out)
+	}
+	return nil
+}
+
+// pushFile pushes a single file and verifies it on the device.
+func pushFile(adb adbClient, localPth, devicePth string, apiLevel int) error {
+	if out, err := adb.command("push", localPth, devicePth).RunAndReturnTrimmedCombinedOutput(); err != nil {
+		return fmt.Errorf("failed to push %s to %s, output: %s, error: %s", localPth, devicePth, out, err)
+	}
+	return verifyPushedFile(adb, localPth, devicePth, apiLevel)
+}
+
+// scanMediaFile adds the file to the media store.
+func scanMediaFile(adb adbClient, devicePth string) error {
+	cmd := shellquote.Join("am", "broadcast", "-a", "android.intent.action.MEDIA_SCANNER_SCAN_FILE", "-d", "file://"+devicePth)
+	if out, err := adb.shell(cmd); err != nil {
+		return fmt.Errorf("failed to scan %s, output: %s, error: %s", devicePth, out, err)
+	}
+	return nil
+}
+
+// pushFiles pushes the files onto the device and adds the pushed media files to the media store.
+func pushFiles(adb adbClient, pushes []filePush) error {
+	level, err := apiLevel(adb)
+	if err != nil {
+		return err
+	}
+
+	for _, push := range pushes {
+		log.Printf("> Pushing %s to %s", push.localPth, push.devicePth)
+
+		files, err := pushedFiles(push)
+		if err != nil {
+			return fmt.Errorf("failed to list files of %s, error: %s", push.localPth, err)
+		}
+
+		localPths := []string{}
+		for localPth := range files {
+			localPths = append(localPths, localPth)
+		}
+		sort.Strings(localPths)
+
+		mediaFiles := 0
+		for _, localPth := range localPths {
+			devicePth := files[localPth]
+			if err := pushFile(adb, localPth, devicePth, level); err != nil {
+				return err
+			}
+
+			if isMediaFile(devicePth) {
+				if err := scanMediaFile(adb, devicePth); err != nil {
+					return err
+				}
+				mediaFiles++
+			}
+		}
+
+		log.Donef("> Pushed %d file(s), %d added to the media store", len(files), mediaFiles)
+	}
+	return nil
+}
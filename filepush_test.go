@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestParseListedFileSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    int64
+		wantErr bool
+	}{
+		{
+			name: "toolbox",
+			out:  "-rw-r--r-- root     root         1234 2018-01-01 00:00 hosts",
+			want: 1234,
+		},
+		{
+			name: "toybox",
+			out:  "-rw-r--r-- 1 root root 1234 2018-01-01 00:00 /system/etc/hosts",
+			want: 1234,
+		},
+		{
+			name: "empty file",
+			out:  "-rw-rw---- root     sdcard_r        0 2014-06-30 12:00 empty.txt",
+			want: 0,
+		},
+		{
+			name: "file name with date",
+			out:  "-rw-rw---- 1 root sdcard_rw 42 2020-02-03 10:11 /sdcard/report 2019-01-01 .txt",
+			want: 42,
+		},
+		{
+			name:    "missing file",
+			out:     "/sdcard/missing.txt: No such file or directory",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseListedFileSize(tt.out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseListedFileSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseListedFileSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/kballard/go-shellquote"
+)
+
+const hostsFilePth = "/system/etc/hosts"
+
+// hostMapping maps a hostname to an IP address in the device's hosts file.
+type hostMapping struct {
+	hostname string
+	ip       string
+}
+
+// parseHostMappings parses the hosts input: one hostname:ip mapping per line.
+func parseHostMappings(value string) ([]hostMapping, error) {
+	mappings := []hostMapping{}
+	for _, line := range splitLines(value) {
+		split := strings.SplitN(line, ":", 2)
+		if len(split) != 2 {
+			return nil, fmt.Errorf("invalid host mapping, should be hostname:ip: %s", line)
+		}
+
+		hostname, ip := strings.TrimSpace(split[0]), strings.TrimSpace(split[1])
+		if hostname == "" || strings.ContainsAny(hostname, " \t") || net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid host mapping, should be hostname:ip: %s", line)
+		}
+		mappings = append(mappings, hostMapping{hostname: hostname, ip: ip})
+	}
+	return mappings, nil
+}
+
+// parseDNSServers parses the dns_servers input: comma separated IP addresses.
+func parseDNSServers(value string) ([]string, error) {
+	servers := []string{}
+	for _, server := range strings.Split(value, ",") {
+		if server = strings.TrimSpace(server); server == "" {
+			continue
+		}
+		if net.ParseIP(server) == nil {
+			return nil, fmt.Errorf("invalid DNS server, should be an IP address: %s", server)
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+func hostsFileContent(mappings []hostMapping) string {
+	lines := []string{"127.0.0.1       localhost", "::1             ip6-localhost"}
+	for _, mapping := range mappings {
+		lines = append(lines, fmt.Sprintf("%-15s %s", mapping.ip, mapping.hostname))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// parsePingAddress returns the resolved address from the first line of the ping or ping6 output, like:
+// PING example.com (10.0.2.2) 56(84) bytes of data.
+// PING example.com(localhost (::1)) 56 data bytes
+func parsePingAddress(out string) (string, bool) {
+	if !strings.HasPrefix(out, "PING") {
+		return "", false
+	}
+	end := strings.Index(out, ")")
+	if end == -1 {
+		return "", false
+	}
+	start := strings.LastIndex(out[:end], "(")
+	if start == -1 {
+		return "", false
+	}
+	return out[start+1 : end], true
+}
+
+// resolvedIP returns the address the device resolves the hostname to, looked up with getent (not available on older devices),
+// or with ping (ping6 for IPv6 addresses), which prints the resolved address even if the host does not answer.
+func resolvedIP(adb adbClient, hostname string, ipv6 bool) (string, error) {
+	out, err := adb.shell(shellquote.Join("getent", "hosts", hostname))
+	if fields := strings.Fields(out); err == nil && len(fields) > 0 && net.ParseIP(fields[0]) != nil {
+		return fields[0], nil
+	}
+
+	ping := "ping"
+	if ipv6 {
+		ping = "ping6"
+	}
+	out, _ = adb.shell(shellquote.Join(ping, "-c1", "-W1", hostname))
+	if ip, ok := parsePingAddress(out); ok {
+		return ip, nil
+	}
+	return "", fmt.Errorf("failed to resolve %s, output: %s", hostname, out)
+}
+
+// writeHostsFile replaces the device's hosts file and checks that the hostnames resolve to the mapped addresses,
+// the emulator needs to be started with -writable-system.
+func writeHostsFile(adb adbClient, mappings []hostMapping) error {
+	level, err := apiLevel(adb)
+	if err != nil {
+		return err
+	}
+
+	if err := remountSystem(adb); err != nil {
+		return err
+	}
+
+	tmpDir, err := ioutil.TempDir("", "hosts")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir, error: %s", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			log.Warnf("Failed to remove temp dir (%s), error: %s", tmpDir, err)
+		}
+	}()
+
+	localPth := filepath.Join(tmpDir, "hosts")
+	if err := ioutil.WriteFile(localPth, []byte(hostsFileContent(mappings)), 0644); err != nil {
+		return fmt.Errorf("failed to write hosts file (%s), error: %s", localPth, err)
+	}
+
+	log.Printf("> Pushing %s", hostsFilePth)
+	if err := pushFile(adb, localPth, hostsFilePth, level); err != nil {
+		return err
+	}
+	if out, err := adb.shell("chmod", "644", hostsFilePth); err != nil {
+		return fmt.Errorf("failed to set permissions of %s, output: %s, error: %s", hostsFilePth, out, err)
+	}
+
+	for _, mapping := range mappings {
+		ip, err := resolvedIP(adb, mapping.hostname, net.ParseIP(mapping.ip).To4() == nil)
+		if err != nil {
+			return err
+		}
+		if !net.ParseIP(ip).Equal(net.ParseIP(mapping.ip)) {
+			return fmt.Errorf("%s resolves to %s instead of %s", mapping.hostname, ip, mapping.ip)
+		}
+		log.Printf("> %s resolves to %s", mapping.hostname, ip)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHostMappings(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []hostMapping
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			value: "",
+			want:  []hostMapping{},
+		},
+		{
+			name:  "IPv4",
+			value: "api.example.com:10.0.2.2",
+			want:  []hostMapping{{hostname: "api.example.com", ip: "10.0.2.2"}},
+		},
+		{
+			name:  "IPv6",
+			value: "api.example.com:::1\ncdn.example.com:2001:db8::8a2e:370:7334",
+			want: []hostMapping{
+				{hostname: "api.example.com", ip: "::1"},
+				{hostname: "cdn.example.com", ip: "2001:db8::8a2e:370:7334"},
+			},
+		},
+		{
+			name:  "spaces and empty lines",
+			value: " api.example.com : 10.0.2.2 \n\n localhost6 : ::1 \n",
+			want: []hostMapping{
+				{hostname: "api.example.com", ip: "10.0.2.2"},
+				{hostname: "localhost6", ip: "::1"},
+			},
+		},
+		{
+			name:    "missing IP",
+			value:   "api.example.com",
+			wantErr: true,
+		},
+		{
+			name:    "missing hostname",
+			value:   ":10.0.2.2",
+			wantErr: true,
+		},
+		{
+			name:    "IPv6 without hostname",
+			value:   "::1",
+			wantErr: true,
+		},
+		{
+			name:    "bracketed IPv6",
+			value:   "api.example.com:[::1]",
+			wantErr: true,
+		},
+		{
+			name:    "invalid IP",
+			value:   "api.example.com:10.0.2",
+			wantErr: true,
+		},
+		{
+			name:    "hostname with space",
+			value:   "api example.com:10.0.2.2",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHostMappings(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHostMappings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseHostMappings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePingAddress(t *testing.T) {
+	tests := []struct {
+		name   string
+		out    string
+		want   string
+		wantOK bool
+	}{
+		{
+			name:   "ping",
+			out:    "PING api.example.com (10.0.2.2) 56(84) bytes of data.",
+			want:   "10.0.2.2",
+			wantOK: true,
+		},
+		{
+			name:   "ping6",
+			out:    "PING api.example.com(::1) 56 data bytes",
+			want:   "::1",
+			wantOK: true,
+		},
+		{
+			name:   "ping6 with reverse lookup",
+			out:    "PING api.example.com(localhost (::1)) 56 data bytes",
+			want:   "::1",
+			wantOK: true,
+		},
+		{
+			name:   "unknown host",
+			out:    "ping: unknown host api.example.com",
+			wantOK: false,
+		},
+		{
+			name:   "missing address",
+			out:    "PING api.example.com",
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parsePingAddress(tt.out)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("parsePingAddress() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
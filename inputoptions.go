@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/sliceutil"
+	"github.com/hashicorp/go-version"
+)
+
+var gpuModes = []string{"auto", "host", "swiftshader_indirect", "off"}
+
+// inputOption is an emulator option generated from a dedicated step input.
+// It is left out if the user sets any of the overriddenBy flags in emulator_options.
+type inputOption struct {
+	args         []string
+	overriddenBy []string
+}
+
+func versionAtLeast(emulatorVersion *version.Version, minVersion string) bool {
+	if emulatorVersion == nil {
+		return true
+	}
+	return !emulatorVersion.LessThan(version.Must(version.NewVersion(minVersion)))
+}
+
+// splitLines returns the non-empty, trimmed lines of a multiline input.
+func splitLines(value string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// writableSystemRequired returns whether the inputs modify the system partition after the boot.
+func writableSystemRequired(configs ConfigsModel) bool {
+	return (configs.CACertificateStore == caCertificateStoreSystem && len(splitLines(configs.CACertificatePaths)) > 0) ||
+		len(splitLines(configs.Hosts)) > 0
+}
+
+// provisioningRequired returns whether the inputs set up anything on the device after it is ready.
+func provisioningRequired(configs ConfigsModel) bool {
+	for _, value := range []string{
+		configs.CACertificatePaths, configs.Hosts, configs.APKPaths, configs.GrantPermissions,
+		configs.AppOps, configs.PushFiles, configs.PostBootCommands,
+	} {
+		if strings.TrimSpace(value) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// bootedDeviceInputs returns the names of the set inputs which act on the booted device, these require WaitForBoot.
+func bootedDeviceInputs(configs ConfigsModel) []string {
+	inputs := []struct {
+		name string
+		set  bool
+	}{
+		{"SaveSnapshot", configs.SaveSnapshot == "true"},
+		{"CleanState", configs.CleanState == "true"},
+		{"DisableAnimations", configs.DisableAnimations == "true"},
+		{"StayAwake", configs.StayAwake == "true"},
+		{"DisableScreenTimeout", configs.DisableScreenTimeout == "true"},
+		{"HideSoftKeyboard", configs.HideSoftKeyboard == "true"},
+		{"DisableImmersiveModeConfirmation", configs.DisableImmersiveModeConfirmation == "true"},
+		{"DisableErrorDialogs", configs.DisableErrorDialogs == "true"},
+		{"Locale", configs.Locale != ""},
+		{"Timezone", configs.Timezone != ""},
+		{"DateTime", configs.DateTime != ""},
+		{"APKPaths", strings.TrimSpace(configs.APKPaths) != ""},
+		{"PushFiles", strings.TrimSpace(configs.PushFiles) != ""},
+		{"CACertificatePaths", strings.TrimSpace(configs.CACertificatePaths) != ""},
+		{"Hosts", strings.TrimSpace(configs.Hosts) != ""},
+		{"GrantPermissions", strings.TrimSpace(configs.GrantPermissions) != ""},
+		{"AppOps", strings.TrimSpace(configs.AppOps) != ""},
+		{"PostBootCommands", strings.TrimSpace(configs.PostBootCommands) != ""},
+	}
+
+	names := []string{}
+	for _, input := range inputs {
+		if input.set {
+			names = append(names, input.name)
+		}
+	}
+	return names
+}
+
+func validatePositiveIntInput(name, value string) error {
+	if value == "" {
+		return nil
+	}
+	if i, err := strconv.Atoi(value); err != nil || i <= 0 {
+		return fmt.Errorf("invalid %s parameter, should be a positive number: %s", name, value)
+	}
+	return nil
+}
+
+// inputOptions translates the dedicated emulator inputs into emulator options supported by the given emulator version.
+func inputOptions(configs ConfigsModel, emulatorVersion *version.Version) []inputOption {
+	options := []inputOption{}
+
+	if configs.Headless == "true" {
+		options = append(options, inputOption{
+			args:         []string{"-no-window"},
+			overriddenBy: []string{"-no-window", "-qt-hide-window"},
+		})
+	}
+
+	if configs.GPUMode != "" && configs.GPUMode != "auto" {
+		mode := configs.GPUMode
+		if mode == "swiftshader_indirect" && !versionAtLeast(emulatorVersion, "27.1.0") {
+			log.Warnf("GPU mode swiftshader_indirect requires emulator 27.1.0 or newer, using swiftshader")
+			mode = "swiftshader"
+		}
+		options = append(options, inputOption{args: []string{"-gpu", mode}, overriddenBy: []string{"-gpu"}})
+	}
+
+	if configs.Memory != "" {
+		options = append(options, inputOption{args: []string{"-memory", configs.Memory}, overriddenBy: []string{"-memory"}})
+	}
+
+	if configs.Cores != "" {
+		options = append(options, inputOption{args: []string{"-cores", configs.Cores}, overriddenBy: []string{"-cores"}})
+	}
+
+	if configs.CameraFront != "" {
+		options = append(options, inputOption{args: []string{"-camera-front", configs.CameraFront}, overriddenBy: []string{"-camera-front"}})
+	}
+
+	if configs.CameraBack != "" {
+		options = append(options, inputOption{args: []string{"-camera-back", configs.CameraBack}, overriddenBy: []string{"-camera-back"}})
+	}
+
+	if configs.NetworkSpeed != "" {
+		options = append(options, inputOption{args: []string{"-netspeed", configs.NetworkSpeed}, overriddenBy: []string{"-netspeed", "-netfast"}})
+	}
+
+	if configs.NetworkLatency != "" {
+		options = append(options, inputOption{args: []string{"-netdelay", configs.NetworkLatency}, overriddenBy: []string{"-netdelay", "-netfast"}})
+	}
+
+	if configs.Audio == "false" {
+		flag := "-no-audio"
+		if !versionAtLeast(emulatorVersion, "25.3.0") {
+			flag = "-noaudio"
+		}
+		options = append(options, inputOption{args: []string{flag}, overriddenBy: []string{"-no-audio", "-noaudio"}})
+	}
+
+	if configs.ReadOnlySystem == "true" {
+		options = append(options, inputOption{args: []string{"-read-only"}, overriddenBy: []string{"-read-only"}})
+	}
+
+	if writableSystemRequired(configs) {
+		options = append(options, inputOption{args: []string{"-writable-system"}, overriddenBy: []string{"-writable-system"}})
+	}
+
+	if configs.HTTPProxy != "" {
+		options = append(options, inputOption{args: []string{"-http-proxy", configs.HTTPProxy}, overriddenBy: []string{"-http-proxy"}})
+	}
+
+	if servers, err := parseDNSServers(configs.DNSServers); err == nil && len(servers) > 0 {
+		options = append(options, inputOption{args: []string{"-dns-server", strings.Join(servers, ",")}, overriddenBy: []string{"-dns-server"}})
+	}
+
+	return options
+}
+
+// mergeEmulatorOptions returns the input options followed by the user's emulator_options,
+// leaving out the input options overridden by the user.
+func mergeEmulatorOptions(options []inputOption, userOptions []string) []string {
+	merged := []string{}
+	for _, option := range options {
+		overridden := false
+		for _, flag := range option.overriddenBy {
+			if sliceutil.IsStringInSlice(flag, userOptions) {
+				overridden = true
+				break
+			}
+		}
+
+		if overridden {
+			log.Printf("%s is overridden by emulator_options", option.args[0])
+			continue
+		}
+		merged = append(merged, option.args...)
+	}
+	return append(merged, userOptions...)
+}
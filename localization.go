@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/kballard/go-shellquote"
+)
+
+const (
+	dateTimeInputLayout  = "2006-01-02T15:04:05"
+	dateTimeTolerance    = time.Minute
+	frameworkBootTimeout = 5 * time.Minute
+)
+
+// rootADB restarts adbd with root permissions, required to set the persistent system properties and the date.
+// Restarting adbd ends the logcat stream, so the logcat capture is restarted from the time of the adbd restart.
+func rootADB(adb adbClient) error {
+	since := logcat.deviceTime()
+
+	out, err := adb.command("root").RunAndReturnTrimmedCombinedOutput()
+	if err != nil || strings.Contains(out, "cannot run as root") {
+		return fmt.Errorf("failed to restart adbd as root, output: %s, error: %v", out, err)
+	}
+	if strings.Contains(out, "already running as root") {
+		return nil
+	}
+
+	if out, err := adb.command("wait-for-device").RunAndReturnTrimmedCombinedOutput(); err != nil {
+		return fmt.Errorf("failed to wait for device, output: %s, error: %s", out, err)
+	}
+
+	logcat.restart(adb, since)
+	return nil
+}
+
+// restartFramework restarts the Android framework to apply the new locale and waits until it boots again.
+func restartFramework(adb adbClient) error {
+	// sys.boot_completed is not cleared by the framework restart, reset it to detect the new boot
+	if out, err := adb.shell("setprop", "sys.boot_completed", "0"); err != nil {
+		return fmt.Errorf("failed to reset sys.boot_completed, output: %s, error: %s", out, err)
+	}
+	if out, err := adb.shell("setprop", "ctl.restart", "zygote"); err != nil {
+		return fmt.Errorf("failed to restart zygote, output: %s, error: %s", out, err)
+	}
+
+	deadline := time.Now().Add(frameworkBootTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(5 * time.Second)
+
+		log.Printf("> Checking if framework restarted...")
+
+		if out, err := adb.shell("getprop", "sys.boot_completed"); err == nil && out == "1" {
+			return nil
+		}
+	}
+	return fmt.Errorf("framework did not restart in %.0fs", frameworkBootTimeout.Seconds())
+}
+
+// setLocale sets the device locale, given as a BCP 47 language tag (like de-DE), and restarts the framework to apply it.
+func setLocale(adb adbClient, apiLevel int, locale string) error {
+	locale = strings.Replace(locale, "_", "-", -1)
+
+	properties := map[string]string{"persist.sys.locale": locale}
+	if apiLevel < 21 {
+		split := strings.SplitN(locale, "-", 2)
+		properties = map[string]string{"persist.sys.language": split[0], "persist.sys.country": ""}
+		if len(split) == 2 {
+			properties["persist.sys.country"] = split[1]
+		}
+	}
+
+	for key, value := range properties {
+		// the value is quoted, an empty country would otherwise leave setprop without its value argument
+		if out, err := adb.shell(shellquote.Join("setprop", key, value)); err != nil {
+			return fmt.Errorf("failed to set %s, output: %s, error: %s", key, out, err)
+		}
+	}
+
+	if err := restartFramework(adb); err != nil {
+		return err
+	}
+
+	for key, value := range properties {
+		if out, err := adb.shell("getprop", key); err != nil {
+			return fmt.Errorf("failed to get %s, output: %s, error: %s", key, out, err)
+		} else if out != value {
+			return fmt.Errorf("failed to set %s, expected: %s, actual: %s", key, value, out)
+		}
+	}
+	return nil
+}
+
+// alarmSetTimeZoneTransaction returns the transaction code of IAlarmManager.setTimeZone on the given API level,
+// or false if it is not known.
+func alarmSetTimeZoneTransaction(apiLevel int) (string, bool) {
+	switch {
+	case apiLevel <= 18:
+		return "5", true
+	case apiLevel <= 33:
+		return "3", true
+	default:
+		return "", false
+	}
+}
+
+// setTimezone disables the automatic time zone and sets the given Olson time zone ID (like Europe/Berlin).
+// The time zone is set through the alarm service, which notifies the running apps and does not require root,
+// setting the persist.sys.timezone property directly (as root) is the fallback.
+func setTimezone(adb adbClient, apiLevel int, timezone string) error {
+	if out, err := adb.shell("settings", "put", "global", "auto_time_zone", "0"); err != nil {
+		return fmt.Errorf("failed to disable automatic time zone, output: %s, error: %s", out, err)
+	}
+
+	if transaction, ok := alarmSetTimeZoneTransaction(apiLevel); ok {
+		if out, err := adb.shell("service", "call", "alarm", transaction, "s16", timezone); err != nil {
+			log.Warnf("> Failed to set time zone through the alarm service, output: %s, error: %s", out, err)
+		}
+		if current, err := adb.shell("getprop", "persist.sys.timezone"); err == nil && current == timezone {
+			return nil
+		}
+	}
+
+	if err := rootADB(adb); err != nil {
+		return err
+	}
+	if out, err := adb.shell("setprop", "persist.sys.timezone", timezone); err != nil {
+		return fmt.Errorf("failed to set persist.sys.timezone, output: %s, error: %s", out, err)
+	}
+
+	out, err := adb.shell("getprop", "persist.sys.timezone")
+	if err != nil {
+		return fmt.Errorf("failed to get persist.sys.timezone, output: %s, error: %s", out, err)
+	}
+	if out != timezone {
+		return fmt.Errorf("failed to set time zone, expected: %s, actual: %s", timezone, out)
+	}
+	return nil
+}
+
+// setDateTime disables the automatic time and sets the device clock (given in UTC).
+func setDateTime(adb adbClient, apiLevel int, dateTime time.Time) error {
+	if out, err := adb.shell("settings", "put", "global", "auto_time", "0"); err != nil {
+		return fmt.Errorf("failed to disable automatic time, output: %s, error: %s", out, err)
+	}
+
+	// toybox date (API 23+) expects MMDDhhmm[[CC]YY][.ss], the older toolbox date expects -s YYYYMMDD.hhmmss
+	args := []string{"date", "-u", dateTime.UTC().Format("010215042006.05")}
+	if apiLevel < 23 {
+		args = []string{"date", "-u", "-s", dateTime.UTC().Format("20060102.150405")}
+	}
+	if out, err := adb.shell(args...); err != nil {
+		return fmt.Errorf("failed to set date, output: %s, error: %s", out, err)
+	}
+
+	out, err := adb.shell("date", "+%s")
+	if err != nil {
+		return fmt.Errorf("failed to get date, output: %s, error: %s", out, err)
+	}
+	seconds, err := strconv.ParseInt(out, 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse date (%s), error: %s", out, err)
+	}
+
+	if diff := time.Unix(seconds, 0).Sub(dateTime); diff < -dateTimeTolerance || diff > dateTimeTolerance {
+		return fmt.Errorf("failed to set date, expected: %s, actual: %s", dateTime.UTC(), time.Unix(seconds, 0).UTC())
+	}
+	return nil
+}
+
+// localizeDevice applies the locale, time zone and date inputs.
+// Setting the locale and the date requires root.
+func localizeDevice(adb adbClient, configs ConfigsModel) error {
+	level, err := apiLevel(adb)
+	if err != nil {
+		return err
+	}
+
+	if configs.Locale != "" || configs.DateTime != "" {
+		if err := rootADB(adb); err != nil {
+			return err
+		}
+	}
+
+	if configs.Locale != "" {
+		log.Printf("> Setting locale: %s", configs.Locale)
+		if err := setLocale(adb, level, configs.Locale); err != nil {
+			return err
+		}
+	}
+
+	if configs.Timezone != "" {
+		log.Printf("> Setting time zone: %s", configs.Timezone)
+		if err := setTimezone(adb, level, configs.Timezone); err != nil {
+			return err
+		}
+	}
+
+	if configs.DateTime != "" {
+		dateTime, err := time.Parse(dateTimeInputLayout, configs.DateTime)
+		if err != nil {
+			return fmt.Errorf("failed to parse DateTime parameter, error: %s", err)
+		}
+
+		log.Printf("> Setting date: %s", dateTime)
+		if err := setDateTime(adb, level, dateTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
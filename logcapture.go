@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	emulatorLogFileName = "emulator.log"
+	logcatFileName      = "logcat.log"
+)
+
+func createLogFile(outputDir, name string) (*os.File, error) {
+	if err := os.MkdirAll(outputDir, 0777); err != nil {
+		return nil, fmt.Errorf("failed to create output dir (%s), error: %s", outputDir, err)
+	}
+
+	pth := filepath.Join(outputDir, name)
+	file, err := os.Create(pth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log file (%s), error: %s", pth, err)
+	}
+	return file, nil
+}
+
+// logcatCapture streams the device's logcat into a file.
+// The logcat process is left running, so it keeps capturing while the subsequent steps use the device.
+// Restarting adbd (adb root) ends the stream, so it has to be restarted after every adbd restart.
+type logcatCapture struct {
+	mutex sync.Mutex
+	adb   adbClient
+	file  *os.File
+	cmd   *exec.Cmd
+}
+
+// logcat is the running logcat capture, nil if the logcat is not captured.
+var logcat *logcatCapture
+
+func startLogcat(adb adbClient, file *os.File) (*logcatCapture, error) {
+	capture := &logcatCapture{adb: adb, file: file}
+	return capture, capture.start("")
+}
+
+// start starts streaming the logcat, from the given device time (MM-DD hh:mm:ss.mmm) if set.
+func (capture *logcatCapture) start(since string) error {
+	args := []string{"logcat", "-v", "threadtime"}
+	if since != "" {
+		args = append(args, "-T", since)
+	}
+
+	cmd := capture.adb.command(args...).GetCmd()
+	cmd.Stdout = capture.file
+	cmd.Stderr = capture.file
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		_ = cmd.Wait()
+	}()
+
+	capture.cmd = cmd
+	return nil
+}
+
+// deviceTime returns the current device time in the format logcat -T expects, or an empty string if it is not available.
+func (capture *logcatCapture) deviceTime() string {
+	if capture == nil {
+		return ""
+	}
+
+	out, err := capture.adb.shell("date", "+'%m-%d %H:%M:%S.000'")
+	if err != nil {
+		return ""
+	}
+	return strings.Trim(out, "'")
+}
+
+// restart stops the current stream and starts a new one for the given device, from the given device time if set.
+func (capture *logcatCapture) restart(adb adbClient, since string) {
+	if capture == nil {
+		return
+	}
+
+	capture.mutex.Lock()
+	defer capture.mutex.Unlock()
+
+	if capture.cmd != nil && capture.cmd.Process != nil {
+		_ = capture.cmd.Process.Kill()
+	}
+
+	capture.adb = adb
+	if err := capture.start(since); err != nil {
+		log.Warnf("Failed to restart logcat, error: %s", err)
+	}
+}
@@ -7,16 +7,18 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/errorutil"
 	"github.com/bitrise-io/go-utils/log"
 	"github.com/bitrise-io/go-utils/pathutil"
 	"github.com/bitrise-io/go-utils/sliceutil"
 	"github.com/bitrise-tools/go-android/adbmanager"
-	"github.com/bitrise-tools/go-android/emulatormanager"
 	"github.com/bitrise-tools/go-android/sdk"
 	"github.com/bitrise-tools/go-steputils/tools"
 	"github.com/kballard/go-shellquote"
@@ -24,12 +26,72 @@ import (
 
 // ConfigsModel ...
 type ConfigsModel struct {
-	EmulatorName    string
-	Skin            string
-	EmulatorOptions string
-	AndroidHome     string
-	WaitForBoot     string
-	BootTimeout     string
+	EmulatorName    string `json:"emulator_name"`
+	Skin            string `json:"skin"`
+	EmulatorOptions string `json:"emulator_options"`
+	AndroidHome     string `json:"android_home"`
+	WaitForBoot     string `json:"wait_for_boot"`
+	BootTimeout     string `json:"boot_timeout"`
+	OutputDir       string `json:"output_dir"`
+
+	SerialTimeout       string `json:"serial_timeout"`
+	BootCompleteTimeout string `json:"boot_complete_timeout"`
+	ReadinessTimeout    string `json:"readiness_timeout"`
+	ProvisioningTimeout string `json:"provisioning_timeout"`
+
+	AccelerationPolicy      string `json:"acceleration_policy"`
+	UnsupportedOptionPolicy string `json:"unsupported_option_policy"`
+
+	Headless       string `json:"headless"`
+	GPUMode        string `json:"gpu_mode"`
+	Memory         string `json:"memory"`
+	Cores          string `json:"cores"`
+	CameraFront    string `json:"camera_front"`
+	CameraBack     string `json:"camera_back"`
+	NetworkSpeed   string `json:"network_speed"`
+	NetworkLatency string `json:"network_latency"`
+	Audio          string `json:"audio"`
+	ReadOnlySystem string `json:"read_only_system"`
+
+	SnapshotName                string `json:"snapshot_name"`
+	SaveSnapshot                string `json:"save_snapshot"`
+	DeleteIncompatibleSnapshots string `json:"delete_incompatible_snapshots"`
+	SnapshotMaxAge              string `json:"snapshot_max_age"`
+	AVDCacheDir                 string `json:"avd_cache_dir"`
+
+	CleanState      string `json:"clean_state"`
+	DiskSpacePolicy string `json:"disk_space_policy"`
+
+	DisableAnimations                string `json:"disable_animations"`
+	StayAwake                        string `json:"stay_awake"`
+	DisableScreenTimeout             string `json:"disable_screen_timeout"`
+	HideSoftKeyboard                 string `json:"hide_soft_keyboard"`
+	DisableImmersiveModeConfirmation string `json:"disable_immersive_mode_confirmation"`
+	DisableErrorDialogs              string `json:"disable_error_dialogs"`
+
+	Locale   string `json:"locale"`
+	Timezone string `json:"timezone"`
+	DateTime string `json:"date_time"`
+
+	APKPaths  string `json:"apk_paths"`
+	PushFiles string `json:"push_files"`
+
+	HTTPProxy          string `json:"http_proxy"`
+	CACertificatePaths string `json:"ca_certificate_paths"`
+	CACertificateStore string `json:"ca_certificate_store"`
+
+	Hosts      string `json:"hosts"`
+	DNSServers string `json:"dns_servers"`
+
+	GrantPermissions string `json:"grant_permissions"`
+	AppOps           string `json:"app_ops"`
+
+	PostBootCommands        string `json:"post_boot_commands"`
+	PostBootCommandsOnError string `json:"post_boot_commands_on_error"`
+	PostBootCommandTimeout  string `json:"post_boot_command_timeout"`
+
+	HealthWatchdog         string `json:"health_watchdog"`
+	HealthWatchdogInterval string `json:"health_watchdog_interval"`
 }
 
 func createConfigsModelFromEnvs() ConfigsModel {
@@ -40,10 +102,72 @@ func createConfigsModelFromEnvs() ConfigsModel {
 		AndroidHome:     os.Getenv("android_home"),
 		WaitForBoot:     os.Getenv("wait_for_boot"),
 		BootTimeout:     os.Getenv("boot_timeout"),
+		OutputDir:       os.Getenv("output_dir"),
+
+		SerialTimeout:       os.Getenv("serial_timeout"),
+		BootCompleteTimeout: os.Getenv("boot_complete_timeout"),
+		ReadinessTimeout:    os.Getenv("readiness_timeout"),
+		ProvisioningTimeout: os.Getenv("provisioning_timeout"),
+
+		AccelerationPolicy:      os.Getenv("acceleration_policy"),
+		UnsupportedOptionPolicy: os.Getenv("unsupported_option_policy"),
+
+		Headless:       os.Getenv("headless"),
+		GPUMode:        os.Getenv("gpu_mode"),
+		Memory:         os.Getenv("memory"),
+		Cores:          os.Getenv("cores"),
+		CameraFront:    os.Getenv("camera_front"),
+		CameraBack:     os.Getenv("camera_back"),
+		NetworkSpeed:   os.Getenv("network_speed"),
+		NetworkLatency: os.Getenv("network_latency"),
+		Audio:          os.Getenv("audio"),
+		ReadOnlySystem: os.Getenv("read_only_system"),
+
+		SnapshotName:                os.Getenv("snapshot_name"),
+		SaveSnapshot:                os.Getenv("save_snapshot"),
+		DeleteIncompatibleSnapshots: os.Getenv("delete_incompatible_snapshots"),
+		SnapshotMaxAge:              os.Getenv("snapshot_max_age"),
+		AVDCacheDir:                 os.Getenv("avd_cache_dir"),
+
+		CleanState:      os.Getenv("clean_state"),
+		DiskSpacePolicy: os.Getenv("disk_space_policy"),
+
+		DisableAnimations:                os.Getenv("disable_animations"),
+		StayAwake:                        os.Getenv("stay_awake"),
+		DisableScreenTimeout:             os.Getenv("disable_screen_timeout"),
+		HideSoftKeyboard:                 os.Getenv("hide_soft_keyboard"),
+		DisableImmersiveModeConfirmation: os.Getenv("disable_immersive_mode_confirmation"),
+		DisableErrorDialogs:              os.Getenv("disable_error_dialogs"),
+
+		Locale:   os.Getenv("locale"),
+		Timezone: os.Getenv("timezone"),
+		DateTime: os.Getenv("date_time"),
+
+		APKPaths:  os.Getenv("apk_paths"),
+		PushFiles: os.Getenv("push_files"),
+
+		HTTPProxy:          os.Getenv("http_proxy"),
+		CACertificatePaths: os.Getenv("ca_certificate_paths"),
+		CACertificateStore: os.Getenv("ca_certificate_store"),
+
+		Hosts:      os.Getenv("hosts"),
+		DNSServers: os.Getenv("dns_servers"),
+
+		GrantPermissions: os.Getenv("grant_permissions"),
+		AppOps:           os.Getenv("app_ops"),
+
+		PostBootCommands:        os.Getenv("post_boot_commands"),
+		PostBootCommandsOnError: os.Getenv("post_boot_commands_on_error"),
+		PostBootCommandTimeout:  os.Getenv("post_boot_command_timeout"),
+
+		HealthWatchdog:         os.Getenv("health_watchdog"),
+		HealthWatchdogInterval: os.Getenv("health_watchdog_interval"),
 	}
 }
 
 func (configs ConfigsModel) print() {
+	configs = redactedConfigs(configs)
+
 	log.Infof("Configs:")
 	log.Printf("- EmulatorName: %s", configs.EmulatorName)
 	log.Printf("- Skin: %s", configs.Skin)
@@ -51,6 +175,53 @@ func (configs ConfigsModel) print() {
 	log.Printf("- AndroidHome: %s", configs.AndroidHome)
 	log.Printf("- WaitForBoot: %s", configs.WaitForBoot)
 	log.Printf("- BootTimeout: %s", configs.BootTimeout)
+	log.Printf("- OutputDir: %s", configs.OutputDir)
+	log.Printf("- SerialTimeout: %s", configs.SerialTimeout)
+	log.Printf("- BootCompleteTimeout: %s", configs.BootCompleteTimeout)
+	log.Printf("- ReadinessTimeout: %s", configs.ReadinessTimeout)
+	log.Printf("- ProvisioningTimeout: %s", configs.ProvisioningTimeout)
+	log.Printf("- AccelerationPolicy: %s", configs.AccelerationPolicy)
+	log.Printf("- UnsupportedOptionPolicy: %s", configs.UnsupportedOptionPolicy)
+	log.Printf("- Headless: %s", configs.Headless)
+	log.Printf("- GPUMode: %s", configs.GPUMode)
+	log.Printf("- Memory: %s", configs.Memory)
+	log.Printf("- Cores: %s", configs.Cores)
+	log.Printf("- CameraFront: %s", configs.CameraFront)
+	log.Printf("- CameraBack: %s", configs.CameraBack)
+	log.Printf("- NetworkSpeed: %s", configs.NetworkSpeed)
+	log.Printf("- NetworkLatency: %s", configs.NetworkLatency)
+	log.Printf("- Audio: %s", configs.Audio)
+	log.Printf("- ReadOnlySystem: %s", configs.ReadOnlySystem)
+	log.Printf("- SnapshotName: %s", configs.SnapshotName)
+	log.Printf("- SaveSnapshot: %s", configs.SaveSnapshot)
+	log.Printf("- DeleteIncompatibleSnapshots: %s", configs.DeleteIncompatibleSnapshots)
+	log.Printf("- SnapshotMaxAge: %s", configs.SnapshotMaxAge)
+	log.Printf("- AVDCacheDir: %s", configs.AVDCacheDir)
+	log.Printf("- CleanState: %s", configs.CleanState)
+	log.Printf("- DiskSpacePolicy: %s", configs.DiskSpacePolicy)
+	log.Printf("- DisableAnimations: %s", configs.DisableAnimations)
+	log.Printf("- StayAwake: %s", configs.StayAwake)
+	log.Printf("- DisableScreenTimeout: %s", configs.DisableScreenTimeout)
+	log.Printf("- HideSoftKeyboard: %s", configs.HideSoftKeyboard)
+	log.Printf("- DisableImmersiveModeConfirmation: %s", configs.DisableImmersiveModeConfirmation)
+	log.Printf("- DisableErrorDialogs: %s", configs.DisableErrorDialogs)
+	log.Printf("- Locale: %s", configs.Locale)
+	log.Printf("- Timezone: %s", configs.Timezone)
+	log.Printf("- DateTime: %s", configs.DateTime)
+	log.Printf("- APKPaths: %s", configs.APKPaths)
+	log.Printf("- PushFiles: %s", configs.PushFiles)
+	log.Printf("- HTTPProxy: %s", configs.HTTPProxy)
+	log.Printf("- CACertificatePaths: %s", configs.CACertificatePaths)
+	log.Printf("- CACertificateStore: %s", configs.CACertificateStore)
+	log.Printf("- Hosts: %s", configs.Hosts)
+	log.Printf("- DNSServers: %s", configs.DNSServers)
+	log.Printf("- GrantPermissions: %s", configs.GrantPermissions)
+	log.Printf("- AppOps: %s", configs.AppOps)
+	log.Printf("- PostBootCommands: %s", configs.PostBootCommands)
+	log.Printf("- PostBootCommandsOnError: %s", configs.PostBootCommandsOnError)
+	log.Printf("- PostBootCommandTimeout: %s", configs.PostBootCommandTimeout)
+	log.Printf("- HealthWatchdog: %s", configs.HealthWatchdog)
+	log.Printf("- HealthWatchdogInterval: %s", configs.HealthWatchdogInterval)
 }
 
 func (configs ConfigsModel) validate() error {
@@ -66,6 +237,126 @@ func (configs ConfigsModel) validate() error {
 	if configs.BootTimeout == "" {
 		return errors.New("no BootTimeout parameter specified")
 	}
+	if !sliceutil.IsStringInSlice(configs.AccelerationPolicy, []string{accelerationPolicyWarn, accelerationPolicyFail, accelerationPolicyNoAccel}) {
+		return fmt.Errorf("invalid AccelerationPolicy parameter: %s", configs.AccelerationPolicy)
+	}
+	if !sliceutil.IsStringInSlice(configs.UnsupportedOptionPolicy, []string{unsupportedOptionPolicyWarn, unsupportedOptionPolicyFail}) {
+		return fmt.Errorf("invalid UnsupportedOptionPolicy parameter: %s", configs.UnsupportedOptionPolicy)
+	}
+	if !sliceutil.IsStringInSlice(configs.Headless, []string{"true", "false"}) {
+		return fmt.Errorf("invalid Headless parameter: %s", configs.Headless)
+	}
+	if configs.GPUMode != "" && !sliceutil.IsStringInSlice(configs.GPUMode, gpuModes) {
+		return fmt.Errorf("invalid GPUMode parameter: %s", configs.GPUMode)
+	}
+	if err := validatePositiveIntInput("Memory", configs.Memory); err != nil {
+		return err
+	}
+	if err := validatePositiveIntInput("Cores", configs.Cores); err != nil {
+		return err
+	}
+	if !sliceutil.IsStringInSlice(configs.Audio, []string{"true", "false"}) {
+		return fmt.Errorf("invalid Audio parameter: %s", configs.Audio)
+	}
+	if !sliceutil.IsStringInSlice(configs.ReadOnlySystem, []string{"true", "false"}) {
+		return fmt.Errorf("invalid ReadOnlySystem parameter: %s", configs.ReadOnlySystem)
+	}
+	if !sliceutil.IsStringInSlice(configs.SaveSnapshot, []string{"true", "false"}) {
+		return fmt.Errorf("invalid SaveSnapshot parameter: %s", configs.SaveSnapshot)
+	}
+	if !sliceutil.IsStringInSlice(configs.DeleteIncompatibleSnapshots, []string{"true", "false"}) {
+		return fmt.Errorf("invalid DeleteIncompatibleSnapshots parameter: %s", configs.DeleteIncompatibleSnapshots)
+	}
+	if err := validatePositiveIntInput("SnapshotMaxAge", configs.SnapshotMaxAge); err != nil {
+		return err
+	}
+	if !sliceutil.IsStringInSlice(configs.CleanState, []string{"true", "false"}) {
+		return fmt.Errorf("invalid CleanState parameter: %s", configs.CleanState)
+	}
+	if !sliceutil.IsStringInSlice(configs.DiskSpacePolicy, []string{diskSpacePolicyWarn, diskSpacePolicyFail}) {
+		return fmt.Errorf("invalid DiskSpacePolicy parameter: %s", configs.DiskSpacePolicy)
+	}
+	for name, value := range map[string]string{
+		"DisableAnimations":                configs.DisableAnimations,
+		"StayAwake":                        configs.StayAwake,
+		"DisableScreenTimeout":             configs.DisableScreenTimeout,
+		"HideSoftKeyboard":                 configs.HideSoftKeyboard,
+		"DisableImmersiveModeConfirmation": configs.DisableImmersiveModeConfirmation,
+		"DisableErrorDialogs":              configs.DisableErrorDialogs,
+	} {
+		if !sliceutil.IsStringInSlice(value, []string{"true", "false"}) {
+			return fmt.Errorf("invalid %s parameter: %s", name, value)
+		}
+	}
+	if configs.DateTime != "" {
+		if _, err := time.Parse(dateTimeInputLayout, configs.DateTime); err != nil {
+			return fmt.Errorf("invalid DateTime parameter, error: %s", err)
+		}
+	}
+	for _, paths := range parseAPKPaths(configs.APKPaths) {
+		for _, pth := range paths {
+			if exist, err := pathutil.IsPathExists(pth); err != nil {
+				return fmt.Errorf("failed to check if apk exist, error: %s", err)
+			} else if !exist {
+				return fmt.Errorf("apk not exist at: %s", pth)
+			}
+		}
+	}
+	pushes, err := parsePushFiles(configs.PushFiles)
+	if err != nil {
+		return err
+	}
+	for _, push := range pushes {
+		if exist, err := pathutil.IsPathExists(push.localPth); err != nil {
+			return fmt.Errorf("failed to check if file to push exist, error: %s", err)
+		} else if !exist {
+			return fmt.Errorf("file to push not exist at: %s", push.localPth)
+		}
+	}
+	if !sliceutil.IsStringInSlice(configs.CACertificateStore, caCertificateStores) {
+		return fmt.Errorf("invalid CACertificateStore parameter: %s, available: %s", configs.CACertificateStore, strings.Join(caCertificateStores, ", "))
+	}
+	for _, pth := range splitLines(configs.CACertificatePaths) {
+		if _, _, err := readCACertificate(pth); err != nil {
+			return fmt.Errorf("invalid CA certificate, error: %s", err)
+		}
+	}
+	if _, err := parseHostMappings(configs.Hosts); err != nil {
+		return err
+	}
+	if _, err := parseDNSServers(configs.DNSServers); err != nil {
+		return err
+	}
+	if _, err := parsePermissionGrants(configs.GrantPermissions); err != nil {
+		return err
+	}
+	if _, err := parseAppOpSettings(configs.AppOps); err != nil {
+		return err
+	}
+	if _, err := postBootCommands(configs.PostBootCommands); err != nil {
+		return err
+	}
+	if !sliceutil.IsStringInSlice(configs.PostBootCommandsOnError, postBootCommandsOnErrorValues) {
+		return fmt.Errorf("invalid PostBootCommandsOnError parameter: %s, available: %s", configs.PostBootCommandsOnError, strings.Join(postBootCommandsOnErrorValues, ", "))
+	}
+	if err := validatePositiveIntInput("PostBootCommandTimeout", configs.PostBootCommandTimeout); err != nil {
+		return err
+	}
+	if !sliceutil.IsStringInSlice(configs.HealthWatchdog, []string{"true", "false"}) {
+		return fmt.Errorf("invalid HealthWatchdog parameter: %s", configs.HealthWatchdog)
+	}
+	if err := validatePositiveIntInput("HealthWatchdogInterval", configs.HealthWatchdogInterval); err != nil {
+		return err
+	}
+	if configs.HealthWatchdog == "true" && configs.OutputDir == "" {
+		return fmt.Errorf("HealthWatchdog requires OutputDir to be set")
+	}
+	if inputs := bootedDeviceInputs(configs); len(inputs) > 0 && configs.WaitForBoot != "true" {
+		return fmt.Errorf("WaitForBoot has to be true to use: %s", strings.Join(inputs, ", "))
+	}
+	if writableSystemRequired(configs) && configs.ReadOnlySystem == "true" {
+		return fmt.Errorf("ReadOnlySystem can not be used together with the system CA certificate store or the hosts file")
+	}
 	if exist, err := pathutil.IsPathExists(configs.AndroidHome); err != nil {
 		return fmt.Errorf("failed to check if android home exist, error: %s", err)
 	} else if !exist {
@@ -157,15 +448,29 @@ func runningDeviceInfos(adb adbmanager.Model) (map[string]string, error) {
 
 func failf(format string, v ...interface{}) {
 	log.Errorf(format, v...)
+
+	report.finish(reportStatusFailed, fmt.Sprintf(format, v...))
+	writeReport()
+
 	os.Exit(1)
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == watchdogCommand {
+		if err := runWatchdog(os.Args[2:]); err != nil {
+			log.Errorf("Watchdog failed, error: %s", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	configs := createConfigsModelFromEnvs()
 
 	fmt.Println()
 	configs.print()
 
+	report.setInputs(configs)
+
 	if err := configs.validate(); err != nil {
 		failf("Issue with input: %s", err)
 	}
@@ -181,8 +486,6 @@ func main() {
 	}
 
 	if !sliceutil.IsStringInSlice(configs.EmulatorName, avdImages) {
-		log.Errorf("AVD image not exists with name: %s", configs.EmulatorName)
-
 		if len(avdImages) > 0 {
 			log.Printf("Available avd images:")
 			for _, avdImage := range avdImages {
@@ -190,7 +493,7 @@ func main() {
 			}
 		}
 
-		os.Exit(1)
+		failf("AVD image not exists with name: %s", configs.EmulatorName)
 	}
 
 	log.Donef("AVD image (%s) exist", configs.EmulatorName)
@@ -223,15 +526,106 @@ func main() {
 	}
 	// ---
 
-	emulator, err := emulatormanager.New(androidSdk)
+	emulator, err := newEmulatorTool(androidSdk.GetAndroidHome())
 	if err != nil {
 		failf("Failed to create emulator model, error: %s", err)
 	}
 
 	//
-	// Start AVD image
+	// Detect tool versions
 	fmt.Println()
-	log.Infof("Start AVD image")
+	log.Infof("Detect tool versions")
+
+	emulatorVersion, err := emulator.Version()
+	if err != nil {
+		log.Warnf("Failed to detect emulator version, error: %s", err)
+	} else {
+		log.Printf("Emulator version: %s", emulatorVersion)
+	}
+
+	platformToolsVersion, err := packageRevision(filepath.Join(androidSdk.GetAndroidHome(), "platform-tools"))
+	if err != nil {
+		log.Warnf("Failed to detect platform-tools version, error: %s", err)
+	} else {
+		log.Printf("Platform-tools version: %s", platformToolsVersion)
+	}
+
+	report.setVersions(emulatorVersion, platformToolsVersion)
+	// ---
+
+	//
+	// Restore AVD cache
+	avdCacheArchive := ""
+	avdCacheRestored := false
+	if configs.AVDCacheDir != "" && configs.CleanState == "true" {
+		fmt.Println()
+		log.Warnf("Clean state is requested, the AVD cache is not restored and not saved")
+	} else if configs.AVDCacheDir != "" {
+		fmt.Println()
+		log.Infof("Restore AVD cache")
+
+		key, err := avdCacheKey(androidSdk.GetAndroidHome(), configs.EmulatorName, emulatorVersion)
+		if err != nil {
+			log.Warnf("Failed to calculate AVD cache key, error: %s", err)
+		} else {
+			avdCacheArchive = avdCacheArchivePth(configs.AVDCacheDir, configs.EmulatorName, key)
+			log.Printf("Cache key: %s", key)
+
+			if exist, err := pathutil.IsPathExists(avdCacheArchive); err != nil {
+				log.Warnf("Failed to check if AVD cache exists, error: %s", err)
+			} else if !exist {
+				log.Printf("No cached AVD state found for the key, the emulator will boot clean")
+			} else if err := verifyAVDCache(avdCacheArchive); err != nil {
+				log.Warnf("Cached AVD state is corrupted, the emulator will boot clean, error: %s", err)
+			} else if err := restoreAVDCache(configs.EmulatorName, avdCacheArchive); err != nil {
+				log.Warnf("Failed to restore cached AVD state, the emulator will boot clean, error: %s", err)
+			} else {
+				avdCacheRestored = true
+				log.Donef("AVD state restored from: %s", avdCacheArchive)
+			}
+		}
+	}
+
+	if err := tools.ExportEnvironmentWithEnvman("BITRISE_EMULATOR_AVD_CACHE_RESTORED", strconv.FormatBool(avdCacheRestored)); err != nil {
+		log.Warnf("Failed to export environment (BITRISE_EMULATOR_AVD_CACHE_RESTORED), error: %s", err)
+	}
+	// ---
+
+	//
+	// Manage snapshots
+	snapshots, err := listSnapshots(configs.EmulatorName)
+	if err != nil {
+		log.Warnf("Failed to list snapshots, error: %s", err)
+	} else if len(snapshots) > 0 {
+		fmt.Println()
+		log.Infof("Snapshots:")
+
+		for _, snapshot := range snapshots {
+			emulatorBuild := snapshot.emulatorVersion
+			if emulatorBuild == "" {
+				emulatorBuild = "unknown"
+			}
+			log.Printf("* %s (%s, created at: %s, emulator: %s)", snapshot.name, formatSize(snapshot.size), snapshot.createdAt.Format(time.RFC3339), emulatorBuild)
+		}
+
+		maxAge := time.Duration(0)
+		if configs.SnapshotMaxAge != "" {
+			days, err := strconv.Atoi(configs.SnapshotMaxAge)
+			if err != nil {
+				failf("Failed to parse SnapshotMaxAge parameter, error: %s", err)
+			}
+			maxAge = time.Duration(days) * 24 * time.Hour
+		}
+
+		if configs.DeleteIncompatibleSnapshots == "true" || maxAge > 0 {
+			reclaimed, err := pruneSnapshots(snapshots, emulatorVersion, configs.DeleteIncompatibleSnapshots == "true", maxAge)
+			if err != nil {
+				log.Warnf("Failed to prune snapshots, error: %s", err)
+			}
+			log.Donef("Reclaimed disk space: %s", formatSize(reclaimed))
+		}
+	}
+	// ---
 
 	options := []string{}
 	if len(configs.EmulatorOptions) > 0 {
@@ -242,120 +636,592 @@ func main() {
 		options = split
 	}
 
-	startEmulatorCommand := emulator.StartEmulatorCommand(configs.EmulatorName, configs.Skin, options...)
-	startEmulatorCmd := startEmulatorCommand.GetCmd()
+	emulatorInputOptions := inputOptions(configs, emulatorVersion)
+	snapshotOption, snapshotBoot := snapshotInputOption(configs.EmulatorName, configs.SnapshotName)
+	if configs.CleanState == "true" && snapshotBoot {
+		// -wipe-data can not be used with -snapshot
+		log.Warnf("Clean state is requested, the snapshot (%s) is not loaded: the emulator cold boots with wiped data (-no-snapshot-load -wipe-data)", configs.SnapshotName)
+		snapshotOption = noSnapshotLoadInputOption()
+	}
+	if len(snapshotOption.args) > 0 {
+		emulatorInputOptions = append(emulatorInputOptions, snapshotOption)
+	}
 
-	e := make(chan error)
+	if configs.CleanState == "true" {
+		emulatorInputOptions = append(emulatorInputOptions, wipeDataInputOption())
+	}
+	options = mergeEmulatorOptions(emulatorInputOptions, options)
 
-	// Redirect output
-	stdoutReader, err := startEmulatorCmd.StdoutPipe()
-	if err != nil {
-		failf("Failed to redirect output, error: %s", err)
+	//
+	// Check hardware acceleration
+	fmt.Println()
+	log.Infof("Check hardware acceleration")
+
+	abi := ""
+	if config, err := readAVDConfig(configs.EmulatorName); err != nil {
+		log.Warnf("Failed to read AVD config, error: %s", err)
+	} else {
+		abi = config["abi.type"]
 	}
 
-	outScanner := bufio.NewScanner(stdoutReader)
-	go func() {
-		for outScanner.Scan() {
-			line := outScanner.Text()
-			fmt.Println(line)
+	acceleration := accelerationUnknown
+	if abi != "" && !accelerationUsed(abi) {
+		log.Printf("The %s ABI is emulated without hardware acceleration on this host (%s), skipping the check", abi, runtime.GOARCH)
+		acceleration = accelerationNotUsed
+	} else if accelerationResult, err := checkAcceleration(*emulator); err != nil {
+		log.Warnf("Failed to check hardware acceleration, error: %s", err)
+	} else if accelerationResult.available {
+		log.Donef("Hardware acceleration is available: %s", accelerationResult.message)
+		acceleration = accelerationAvailable
+	} else {
+		acceleration = accelerationUnavailable
+
+		switch configs.AccelerationPolicy {
+		case accelerationPolicyFail:
+			failf("Hardware acceleration is not available: %s", accelerationResult.message)
+		case accelerationPolicyNoAccel:
+			log.Warnf("Hardware acceleration is not available: %s", accelerationResult.message)
+			if merged := mergeEmulatorOptions([]inputOption{noAccelInputOption()}, options); len(merged) > len(options) {
+				log.Warnf("Starting the emulator with -no-accel, only ARM system images can boot this way")
+				options = merged
+			}
+		default:
+			log.Warnf("Hardware acceleration is not available: %s", accelerationResult.message)
+			log.Warnf("The emulator will boot significantly slower, x86 system images may not boot at all")
 		}
-	}()
-	if err := outScanner.Err(); err != nil {
-		failf("Scanner failed, error: %s", err)
 	}
 
-	// Redirect error
-	stderrReader, err := startEmulatorCmd.StderrPipe()
-	if err != nil {
-		failf("Failed to redirect error, error: %s", err)
+	report.setAcceleration(acceleration)
+	if err := tools.ExportEnvironmentWithEnvman("BITRISE_EMULATOR_ACCELERATION", acceleration); err != nil {
+		log.Warnf("Failed to export environment (BITRISE_EMULATOR_ACCELERATION), error: %s", err)
+	}
+	// ---
+
+	//
+	// Check emulator options
+	fmt.Println()
+	log.Infof("Check emulator options")
+
+	knownFlags, complete := knownEmulatorFlags(*emulator, emulatorVersion)
+	issues, warnings := validateEmulatorOptions(options, knownFlags, complete)
+	for _, warning := range warnings {
+		log.Warnf("- %s (not in the built-in flag list, passed to the emulator as is)", warning)
+	}
+	if len(issues) > 0 {
+		for _, issue := range issues {
+			log.Errorf("- %s", issue)
+		}
+		failf("Invalid emulator options: %s", strings.Join(redactCommandArgs(options), " "))
 	}
 
-	errScanner := bufio.NewScanner(stderrReader)
-	go func() {
-		for errScanner.Scan() {
-			line := errScanner.Text()
-			log.Warnf(line)
+	if emulatorVersion != nil {
+		unsupported, err := unsupportedOptions(options, emulatorVersion)
+		if err != nil {
+			failf("Failed to check emulator options, error: %s", err)
+		}
+
+		for _, requirement := range unsupported {
+			message := fmt.Sprintf("Emulator option (%s) requires emulator version %s or newer, installed: %s", requirement, requirement.minVersion, emulatorVersion)
+			if configs.UnsupportedOptionPolicy == unsupportedOptionPolicyFail {
+				failf("%s", message)
+			}
+			log.Warnf("%s", message)
 		}
-	}()
-	if err := errScanner.Err(); err != nil {
-		failf("Scanner failed, error: %s", err)
 	}
+
+	log.Donef("Emulator options are valid")
 	// ---
 
-	serial := ""
+	//
+	// Check disk space
+	fmt.Println()
+	log.Infof("Check disk space")
 
-	go func() {
-		// Start emulator
-		log.Printf("$ %s", command.PrintableCommandArgs(false, startEmulatorCmd.Args))
-		fmt.Println()
+	if issues, err := checkDiskSpace(configs.EmulatorName); err != nil {
+		log.Warnf("Failed to check disk space, error: %s", err)
+	} else if len(issues) > 0 {
+		for _, issue := range issues {
+			log.Warnf("- %s", issue)
+		}
+		if configs.DiskSpacePolicy == diskSpacePolicyFail {
+			failf("Not enough disk space to start the emulator")
+		}
+	} else {
+		log.Donef("Enough disk space is available")
+	}
+	// ---
+
+	//
+	// Start AVD image
+	serialTimeout, err := parseTimeout(configs.SerialTimeout)
+	if err != nil {
+		failf("Failed to parse SerialTimeout parameter, error: %s", err)
+	}
+	bootCompleteTimeout, err := parseTimeout(configs.BootCompleteTimeout)
+	if err != nil {
+		failf("Failed to parse BootCompleteTimeout parameter, error: %s", err)
+	}
+	readinessTimeout, err := parseTimeout(configs.ReadinessTimeout)
+	if err != nil {
+		failf("Failed to parse ReadinessTimeout parameter, error: %s", err)
+	}
+	provisioningTimeout, err := parseTimeout(configs.ProvisioningTimeout)
+	if err != nil {
+		failf("Failed to parse ProvisioningTimeout parameter, error: %s", err)
+	}
+	timeout, err := strconv.ParseInt(configs.BootTimeout, 10, 64)
+	if err != nil {
+		failf("Failed to parse BootTimeout parameter, error: %s", err)
+	}
 
-		if err := startEmulatorCommand.Run(); err != nil {
-			e <- err
+	var emulatorLogFile *os.File
+	if configs.OutputDir != "" {
+		emulatorLogFile, err = createLogFile(configs.OutputDir, emulatorLogFileName)
+		if err != nil {
+			failf("Failed to create emulator log file, error: %s", err)
+		}
+		defer func() {
+			if err := emulatorLogFile.Close(); err != nil {
+				log.Warnf("Failed to close emulator log file, error: %s", err)
+			}
+		}()
+
+		if err := tools.ExportEnvironmentWithEnvman("BITRISE_EMULATOR_LOG_PATH", emulatorLogFile.Name()); err != nil {
+			log.Warnf("Failed to export environment (BITRISE_EMULATOR_LOG_PATH), error: %s", err)
+		}
+	}
+	writeLog := func(line string) {
+		if emulatorLogFile == nil {
 			return
 		}
-	}()
+		if _, err := fmt.Fprintln(emulatorLogFile, line); err != nil {
+			log.Warnf("Failed to write emulator log file, error: %s", err)
+		}
+	}
 
-	go func() {
-		// Wait until device appears in device list
-		for len(serial) == 0 {
-			time.Sleep(5 * time.Second)
+	// bootEmulator starts the emulator with the given options and waits until it boots (and gets ready if wait_for_boot is set),
+	// within the boot timeout. It fails the step if the boot fails.
+	bootEmulator := func(options []string) emulatorBoot {
+		fmt.Println()
+		log.Infof("Start AVD image")
 
-			log.Printf("> Checking for started device serial...")
+		startEmulatorCommand, err := emulator.StartEmulatorCommand(configs.EmulatorName, configs.Skin, emulatorVersion, options...)
+		if err != nil {
+			failf("Failed to create start emulator command, error: %s", err)
+		}
+		startEmulatorCmd := startEmulatorCommand.GetCmd()
 
-			currentDeviceStateMap, err := runningDeviceInfos(*adb)
-			if err != nil {
-				e <- err
-				return
+		report.setCommand(startEmulatorCmd.Args)
+
+		e := make(chan error, 1)
+		reportError := func(err error) {
+			select {
+			case e <- err:
+			default:
+			}
+		}
+
+		tail := newOutputTail(outputTailSize)
+		snapshotStatus := newSnapshotLoadStatus()
+		exited := make(chan struct{})
+		outputWg := sync.WaitGroup{}
+		outputWg.Add(2)
+
+		// Redirect output
+		stdoutReader, err := startEmulatorCmd.StdoutPipe()
+		if err != nil {
+			failf("Failed to redirect output, error: %s", err)
+		}
+
+		outScanner := bufio.NewScanner(stdoutReader)
+		go func() {
+			defer outputWg.Done()
+
+			for outScanner.Scan() {
+				line := outScanner.Text()
+				fmt.Println(line)
+				writeLog(line)
+				tail.add(line)
+				snapshotStatus.observe(line)
+
+				if pattern := classifyOutputLine(line); pattern != nil {
+					reportError(fatalOutputError{line: line, pattern: *pattern})
+				}
 			}
+		}()
+		if err := outScanner.Err(); err != nil {
+			failf("Scanner failed, error: %s", err)
+		}
+
+		// Redirect error
+		stderrReader, err := startEmulatorCmd.StderrPipe()
+		if err != nil {
+			failf("Failed to redirect error, error: %s", err)
+		}
 
-			serial = currentlyStartedDeviceSerial(deviceStateMap, currentDeviceStateMap)
+		errScanner := bufio.NewScanner(stderrReader)
+		go func() {
+			defer outputWg.Done()
+
+			for errScanner.Scan() {
+				line := errScanner.Text()
+				log.Warnf(line)
+				writeLog(line)
+				tail.add(line)
+				snapshotStatus.observe(line)
+
+				if pattern := classifyOutputLine(line); pattern != nil {
+					reportError(fatalOutputError{line: line, pattern: *pattern})
+				}
+			}
+		}()
+		if err := errScanner.Err(); err != nil {
+			failf("Scanner failed, error: %s", err)
 		}
+		// ---
 
-		log.Donef("> Started device serial: %s", serial)
+		serial := ""
 
-		// Wait until device is booted
-		if configs.WaitForBoot == "true" {
-			bootInProgress := true
-			for bootInProgress {
-				time.Sleep(5 * time.Second)
+		go func() {
+			// Start emulator
+			log.Printf("$ %s", command.PrintableCommandArgs(false, redactCommandArgs(startEmulatorCmd.Args)))
+			fmt.Println()
 
-				log.Printf("> Checking if device booted...")
+			startTime := time.Now()
+			report.startPhase(phaseLaunch)
+			if err := startEmulatorCmd.Start(); err != nil {
+				reportError(err)
+				close(exited)
+				return
+			}
+			report.finishPhase(phaseLaunch)
+
+			// The emulator is not expected to exit while the step is running,
+			// so any exit (even a successful one) means the boot failed.
+			outputWg.Wait()
+			err := startEmulatorCmd.Wait()
+			close(exited)
+
+			exitCode, castErr := errorutil.CmdExitCodeFromError(err)
+			if castErr != nil {
+				reportError(fmt.Errorf("emulator exited, error: %s", err))
+				return
+			}
+
+			reportError(earlyExitError{
+				exitCode: exitCode,
+				elapsed:  time.Since(startTime),
+				tail:     tail.get(),
+			})
+		}()
+
+		go func() {
+			// Wait until device appears in device list
+			if err := runPhase(phaseSerial, serialTimeout, func() error {
+				for len(serial) == 0 {
+					time.Sleep(5 * time.Second)
+
+					log.Printf("> Checking for started device serial...")
+
+					currentDeviceStateMap, err := runningDeviceInfos(*adb)
+					if err != nil {
+						return err
+					}
+
+					serial = currentlyStartedDeviceSerial(deviceStateMap, currentDeviceStateMap)
+					if len(serial) == 0 {
+						report.retryPhase(phaseSerial)
+					}
+				}
+				return nil
+			}); err != nil {
+				reportError(err)
+				return
+			}
+			report.setSerial(serial)
+
+			log.Donef("> Started device serial: %s", serial)
+
+			if logcat != nil {
+				// the emulator is started again after caching its state, keep capturing into the same file
+				logcat.restart(newADBClient(androidSdk.GetAndroidHome(), serial), "")
+			} else if configs.OutputDir != "" {
+				logcatFile, err := createLogFile(configs.OutputDir, logcatFileName)
+				if err != nil {
+					reportError(err)
+					return
+				}
 
-				booted, err := adb.IsDeviceBooted(serial)
+				capture, err := startLogcat(newADBClient(androidSdk.GetAndroidHome(), serial), logcatFile)
 				if err != nil {
-					e <- err
+					log.Warnf("Failed to start logcat, error: %s", err)
+				} else {
+					logcat = capture
+					if err := tools.ExportEnvironmentWithEnvman("BITRISE_EMULATOR_LOGCAT_PATH", logcatFile.Name()); err != nil {
+						log.Warnf("Failed to export environment (BITRISE_EMULATOR_LOGCAT_PATH), error: %s", err)
+					}
+				}
+			}
+
+			// Wait until device is booted
+			if configs.WaitForBoot == "true" {
+				if err := runPhase(phaseBootComplete, bootCompleteTimeout, func() error {
+					for {
+						time.Sleep(5 * time.Second)
+
+						log.Printf("> Checking if device booted...")
+
+						booted, err := adb.IsDeviceBooted(serial)
+						if err != nil {
+							return err
+						}
+						if booted {
+							return nil
+						}
+
+						report.retryPhase(phaseBootComplete)
+					}
+				}); err != nil {
+					reportError(err)
+					return
+				}
+
+				device := newADBClient(androidSdk.GetAndroidHome(), serial)
+
+				if err := runPhase(phaseReadiness, readinessTimeout, func() error {
+					if configs.Locale != "" || configs.Timezone != "" || configs.DateTime != "" {
+						report.startPhase(phaseLocalization)
+						if err := localizeDevice(device, configs); err != nil {
+							return fmt.Errorf("failed to set locale, time zone or date, error: %s", err)
+						}
+						report.finishPhase(phaseLocalization)
+						log.Donef("> Locale, time zone and date set")
+					}
+
+					report.startPhase(phaseUnlock)
+					if err := unlockDevice(device); err != nil {
+						return fmt.Errorf("failed to unlock device, error: %s", err)
+					}
+					report.finishPhase(phaseUnlock)
+					log.Donef("> Device unlocked")
+
+					if settings := devicePreparationSettings(configs); len(settings) > 0 {
+						log.Printf("> Preparing device...")
+						report.startPhase(phaseDevicePreparation)
+						if err := applyDeviceSettings(device, settings); err != nil {
+							return err
+						}
+						report.finishPhase(phaseDevicePreparation)
+						log.Donef("> Device prepared")
+					}
+
+					if configs.CleanState == "true" {
+						log.Printf("> Verifying clean state...")
+						if err := verifyCleanState(device); err != nil {
+							return err
+						}
+						log.Donef("> Device is clean")
+					}
+					return nil
+				}); err != nil {
+					reportError(err)
 					return
 				}
 
-				bootInProgress = !booted
+				log.Donef("> Device booted")
+
+				status, reason := snapshotStatus.get()
+				if status == snapshotStatusColdBoot {
+					log.Warnf("> The emulator cold booted: %s", reason)
+				}
+
+				if configs.SaveSnapshot == "true" && status != snapshotStatusLoaded {
+					snapshotName := configs.SnapshotName
+					if snapshotName == "" {
+						snapshotName = defaultBootSnapshotName
+					}
+
+					log.Printf("> Saving snapshot: %s", snapshotName)
+
+					report.startPhase(phaseSnapshotSave)
+					if err := saveSnapshot(device, snapshotName); err != nil {
+						log.Warnf("Failed to save snapshot, error: %s", err)
+					} else {
+						report.finishPhase(phaseSnapshotSave)
+						log.Donef("> Snapshot saved: %s", snapshotName)
+
+						if err := writeSnapshotMetadata(configs.EmulatorName, snapshotName, emulatorVersion); err != nil {
+							log.Warnf("Failed to write snapshot metadata, error: %s", err)
+						}
+					}
+				}
+			}
+			reportError(nil)
+		}()
+
+		select {
+		case <-time.After(time.Duration(timeout) * time.Second):
+			if err := startEmulatorCmd.Process.Kill(); err != nil {
+				failf("Failed to kill emulator command, error: %s", err)
+			}
+
+			failf("Start emulator timed out")
+		case err := <-e:
+			if _, ok := err.(phaseTimeoutError); ok {
+				if err := startEmulatorCmd.Process.Kill(); err != nil {
+					log.Warnf("Failed to kill emulator command, error: %s", err)
+				}
 			}
+			if fatalErr, ok := err.(fatalOutputError); ok {
+				if err := startEmulatorCmd.Process.Kill(); err != nil {
+					log.Warnf("Failed to kill emulator command, error: %s", err)
+				}
 
-			if err := adb.UnlockDevice(serial); err != nil {
-				failf("UnlockDevice command failed, error: %s", err)
+				fmt.Println()
+				log.Errorf(fatalErr.pattern.explanation)
+				log.Warnf("Hint: %s", fatalErr.pattern.hint)
+			}
+			if exitErr, ok := err.(earlyExitError); ok && len(exitErr.tail) > 0 {
+				fmt.Println()
+				log.Printf("Last %d lines of the emulator output:", len(exitErr.tail))
+				for _, line := range exitErr.tail {
+					log.Printf("%s", line)
+				}
+			}
+			if err != nil {
+				failf("Failed to start emultor, error: %s", err)
 			}
 
-			log.Donef("> Device booted")
 		}
-		e <- nil
-	}()
 
-	timeout, err := strconv.ParseInt(configs.BootTimeout, 10, 64)
-	if err != nil {
-		failf("Failed to parse BootTimeout parameter, error: %s", err)
+		return emulatorBoot{cmd: startEmulatorCmd, serial: serial, snapshotStatus: snapshotStatus, exited: exited}
 	}
 
-	select {
-	case <-time.After(time.Duration(timeout) * time.Second):
-		if err := startEmulatorCmd.Process.Kill(); err != nil {
-			failf("Failed to kill emulator command, error: %s", err)
+	boot := bootEmulator(options)
+	// ---
+
+	//
+	// Cache AVD state
+	if avdCacheArchive != "" && !avdCacheRestored && configs.WaitForBoot == "true" {
+		fmt.Println()
+		log.Infof("Cache AVD state")
+
+		// The emulator keeps writing the userdata images and the snapshots while it runs,
+		// so it is stopped to archive a consistent state, then started again from that state.
+		log.Printf("Stopping the emulator...")
+		if err := stopEmulator(newADBClient(androidSdk.GetAndroidHome(), boot.serial), boot, *adb); err != nil {
+			log.Warnf("Failed to stop the emulator cleanly, the AVD state is not cached, error: %s", err)
+		} else {
+			// The emulator saved its quick boot snapshot on exit, record the version it was saved by, like for the named snapshots
+			if exist, err := pathutil.IsDirExists(snapshotDir(configs.EmulatorName, defaultBootSnapshotName)); err == nil && exist {
+				if err := writeSnapshotMetadata(configs.EmulatorName, defaultBootSnapshotName, emulatorVersion); err != nil {
+					log.Warnf("Failed to write snapshot metadata, error: %s", err)
+				}
+			}
+
+			log.Printf("Packing AVD state...")
+
+			report.startPhase(phaseAVDCachePack)
+			if err := packAVDCache(configs.EmulatorName, avdCacheArchive); err != nil {
+				log.Warnf("Failed to cache AVD state, error: %s", err)
+			} else {
+				report.finishPhase(phaseAVDCachePack)
+				removeStaleAVDCaches(configs.AVDCacheDir, configs.EmulatorName, avdCacheArchive)
+				log.Donef("AVD state cached: %s", avdCacheArchive)
+
+				if err := tools.ExportEnvironmentWithEnvman("BITRISE_EMULATOR_AVD_CACHE_PATH", avdCacheArchive); err != nil {
+					log.Warnf("Failed to export environment (BITRISE_EMULATOR_AVD_CACHE_PATH), error: %s", err)
+				}
+			}
 		}
 
-		failf("Start emulator timed out")
-	case err := <-e:
-		if err != nil {
-			failf("Failed to start emultor, error: %s", err)
+		boot = bootEmulator(relaunchEmulatorOptions(options))
+	}
+	serial := boot.serial
+	snapshotStatus := boot.snapshotStatus
+	// ---
+
+	//
+	// Provision device
+	if configs.WaitForBoot == "true" && provisioningRequired(configs) {
+		fmt.Println()
+		log.Infof("Provision device")
+
+		device := newADBClient(androidSdk.GetAndroidHome(), serial)
+
+		if err := runPhase(phaseProvisioning, provisioningTimeout, func() error {
+			if pths := splitLines(configs.CACertificatePaths); len(pths) > 0 {
+				report.startPhase(phaseCACertificates)
+				if err := installCACertificates(device, pths, configs.CACertificateStore); err != nil {
+					return err
+				}
+				report.finishPhase(phaseCACertificates)
+			}
+
+			if mappings, _ := parseHostMappings(configs.Hosts); len(mappings) > 0 {
+				report.startPhase(phaseHostsFile)
+				if err := writeHostsFile(device, mappings); err != nil {
+					return err
+				}
+				report.finishPhase(phaseHostsFile)
+			}
+
+			if installs := parseAPKPaths(configs.APKPaths); len(installs) > 0 {
+				report.startPhase(phaseAPKInstall)
+				results, err := installAPKs(device, installs)
+				report.setAPKInstalls(results)
+				if err != nil {
+					return err
+				}
+				report.finishPhase(phaseAPKInstall)
+			}
+
+			grants, _ := parsePermissionGrants(configs.GrantPermissions)
+			appOps, _ := parseAppOpSettings(configs.AppOps)
+			if len(grants) > 0 || len(appOps) > 0 {
+				report.startPhase(phasePermissions)
+				failures := applyPermissions(device, grants, appOps)
+				report.setPermissionFailures(failures)
+				report.finishPhase(phasePermissions)
+
+				if len(failures) > 0 {
+					log.Warnf("%d permission(s) and app op(s) could not be applied", len(failures))
+				}
+			}
+
+			if pushes, _ := parsePushFiles(configs.PushFiles); len(pushes) > 0 {
+				report.startPhase(phaseFilePush)
+				if err := pushFiles(device, pushes); err != nil {
+					return err
+				}
+				report.finishPhase(phaseFilePush)
+			}
+
+			if commands, _ := postBootCommands(configs.PostBootCommands); len(commands) > 0 {
+				timeout, _ := parseTimeout(configs.PostBootCommandTimeout)
+				if timeout == 0 {
+					timeout = defaultPostBootCommandTimeout
+				}
+
+				report.startPhase(phasePostBootCommands)
+				results, err := runPostBootCommands(device, commands, configs.PostBootCommandsOnError, timeout)
+				report.setPostBootCommands(results)
+				if err != nil {
+					return err
+				}
+				report.finishPhase(phasePostBootCommands)
+			}
+			return nil
+		}); err != nil {
+			if _, ok := err.(phaseTimeoutError); ok {
+				if err := boot.cmd.Process.Kill(); err != nil {
+					log.Warnf("Failed to kill emulator command, error: %s", err)
+				}
+			}
+			failf("Failed to provision device, error: %s", err)
 		}
 
+		log.Donef("Device provisioned")
 	}
 	// ---
 
@@ -363,6 +1229,41 @@ func main() {
 		log.Warnf("Failed to export environment (BITRISE_EMULATOR_SERIAL), error: %s", err)
 	}
 
+	snapshotLoaded := "false"
+	if status, _ := snapshotStatus.get(); status == snapshotStatusLoaded {
+		snapshotLoaded = "true"
+	}
+	report.setSnapshotLoaded(snapshotLoaded == "true")
+	if err := tools.ExportEnvironmentWithEnvman("BITRISE_EMULATOR_SNAPSHOT_LOADED", snapshotLoaded); err != nil {
+		log.Warnf("Failed to export environment (BITRISE_EMULATOR_SNAPSHOT_LOADED), error: %s", err)
+	}
+
+	if configs.HealthWatchdog == "true" {
+		fmt.Println()
+		log.Infof("Start health watchdog")
+
+		interval, _ := parseTimeout(configs.HealthWatchdogInterval)
+		if interval == 0 {
+			interval = defaultWatchdogInterval
+		}
+
+		timelinePth, pid, err := startWatchdog(newADBClient(androidSdk.GetAndroidHome(), serial), configs.OutputDir, interval)
+		if err != nil {
+			failf("%s", err)
+		}
+		log.Printf("Watchdog (pid: %d) writes the health timeline into: %s", pid, timelinePth)
+
+		if err := tools.ExportEnvironmentWithEnvman("BITRISE_EMULATOR_HEALTH_TIMELINE_PATH", timelinePth); err != nil {
+			log.Warnf("Failed to export environment (BITRISE_EMULATOR_HEALTH_TIMELINE_PATH), error: %s", err)
+		}
+		if err := tools.ExportEnvironmentWithEnvman("BITRISE_EMULATOR_WATCHDOG_PID", strconv.Itoa(pid)); err != nil {
+			log.Warnf("Failed to export environment (BITRISE_EMULATOR_WATCHDOG_PID), error: %s", err)
+		}
+	}
+
+	report.finish(reportStatusSucceeded, "")
+	writeReport()
+
 	fmt.Println()
 	log.Donef("Emulator (%s) booted", serial)
 }
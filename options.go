@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/hashicorp/go-version"
+)
+
+// builtinEmulatorFlags is used if the emulator's -help output is not available,
+// the value tells whether the flag takes an argument.
+var builtinEmulatorFlags = map[string]bool{
+	"-accel":               true,
+	"-camera-back":         true,
+	"-camera-front":        true,
+	"-cores":               true,
+	"-data":                true,
+	"-debug":               true,
+	"-dns-server":          true,
+	"-dpi-device":          true,
+	"-feature":             true,
+	"-force-snapshot-load": false,
+	"-gpu":                 true,
+	"-http-proxy":          true,
+	"-logcat":              true,
+	"-memory":              true,
+	"-netdelay":            true,
+	"-netfast":             false,
+	"-netspeed":            true,
+	"-no-accel":            false,
+	"-no-audio":            false,
+	"-no-boot-anim":        false,
+	"-no-cache":            false,
+	"-no-metrics":          false,
+	"-no-snapshot":         false,
+	"-no-snapshot-load":    false,
+	"-no-snapshot-save":    false,
+	"-no-window":           false,
+	"-noaudio":             false,
+	"-partition-size":      true,
+	"-port":                true,
+	"-ports":               true,
+	"-prop":                true,
+	"-qt-hide-window":      false,
+	"-read-only":           false,
+	"-scale":               true,
+	"-sdcard":              true,
+	"-selinux":             true,
+	"-show-kernel":         false,
+	"-skin":                true,
+	"-snapshot":            true,
+	"-timezone":            true,
+	"-verbose":             false,
+	"-wipe-data":           false,
+	"-writable-system":     false,
+}
+
+// conflictingEmulatorFlags lists the flag pairs which can not be used together.
+var conflictingEmulatorFlags = [][2]string{
+	{"-no-window", "-qt-hide-window"},
+	{"-wipe-data", "-snapshot"},
+	{"-wipe-data", "-force-snapshot-load"},
+	{"-no-snapshot", "-snapshot"},
+	{"-no-snapshot-load", "-snapshot"},
+	{"-no-snapshot-load", "-force-snapshot-load"},
+}
+
+// emulator -help lists the options like:
+//
+//	-sysdir <dir>                  search for system disk images in <dir>
+//	-no-window                     disable graphical window display
+var helpFlagRegexp = regexp.MustCompile(`^\s+(-[a-zA-Z0-9][\w-]*)(\s+<[^>]+>)?`)
+
+func parseEmulatorHelp(help string) map[string]bool {
+	flags := map[string]bool{}
+	for _, line := range strings.Split(help, "\n") {
+		if matches := helpFlagRegexp.FindStringSubmatch(line); len(matches) == 3 {
+			flags[matches[1]] = matches[2] != ""
+		}
+	}
+	return flags
+}
+
+func emulatorFlagsCachePth(emulatorVersion *version.Version) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("emulator-%s-flags.txt", emulatorVersion))
+}
+
+func readEmulatorFlagsCache(pth string) (map[string]bool, error) {
+	content, err := ioutil.ReadFile(pth)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := map[string]bool{}
+	for _, line := range strings.Split(string(content), "\n") {
+		split := strings.Fields(line)
+		if len(split) == 2 {
+			flags[split[0]] = split[1] == "value"
+		}
+	}
+	if len(flags) == 0 {
+		return nil, fmt.Errorf("empty cache: %s", pth)
+	}
+	return flags, nil
+}
+
+func writeEmulatorFlagsCache(pth string, flags map[string]bool) error {
+	lines := []string{}
+	for flag, hasValue := range flags {
+		kind := "switch"
+		if hasValue {
+			kind = "value"
+		}
+		lines = append(lines, flag+" "+kind)
+	}
+	sort.Strings(lines)
+	return ioutil.WriteFile(pth, []byte(strings.Join(lines, "\n")), 0644)
+}
+
+// knownEmulatorFlags returns the flags supported by the installed emulator based on its -help output,
+// the parsed flags are cached per emulator version.
+// Falls back to builtinEmulatorFlags if the -help output is not available, complete is false in this case.
+func knownEmulatorFlags(emulator emulatorTool, emulatorVersion *version.Version) (flags map[string]bool, complete bool) {
+	cachePth := ""
+	if emulatorVersion != nil {
+		cachePth = emulatorFlagsCachePth(emulatorVersion)
+		if flags, err := readEmulatorFlagsCache(cachePth); err == nil {
+			return flags, true
+		}
+	}
+
+	help, err := emulator.Help()
+	if err != nil {
+		log.Warnf("Failed to get emulator flags, using the built-in flag list, error: %s", err)
+		return builtinEmulatorFlags, false
+	}
+
+	flags = parseEmulatorHelp(help)
+	if len(flags) == 0 {
+		log.Warnf("No flags found in the emulator -help output, using the built-in flag list")
+		return builtinEmulatorFlags, false
+	}
+
+	if cachePth != "" {
+		if err := writeEmulatorFlagsCache(cachePth, flags); err != nil {
+			log.Warnf("Failed to cache emulator flags, error: %s", err)
+		}
+	}
+	return flags, true
+}
+
+// editDistance returns the Levenshtein distance of a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func similarFlag(flag string, flags map[string]bool) string {
+	similar := ""
+	bestDistance := 3
+	for knownFlag := range flags {
+		if distance := editDistance(flag, knownFlag); distance < bestDistance || (distance == bestDistance && knownFlag < similar) {
+			similar = knownFlag
+			bestDistance = distance
+		}
+	}
+	return similar
+}
+
+// validateEmulatorOptions checks the options for unknown flags, missing flag arguments and conflicting flags.
+// Everything after -qemu is passed to QEMU as is, so it is not checked.
+// If the flag list is not complete (built-in fallback), unknown flags are returned as warnings instead of issues,
+// and an argument following an unknown flag is treated as its value.
+func validateEmulatorOptions(options []string, flags map[string]bool, complete bool) (issues, warnings []string) {
+	issues = []string{}
+	warnings = []string{}
+	used := map[string]bool{}
+
+	for i := 0; i < len(options); i++ {
+		option := options[i]
+		if option == "-qemu" {
+			break
+		}
+
+		if !strings.HasPrefix(option, "-") {
+			issues = append(issues, fmt.Sprintf("unexpected argument: %s", option))
+			continue
+		}
+
+		hasValue, known := flags[option]
+		if !known {
+			message := fmt.Sprintf("unknown flag: %s", option)
+			if similar := similarFlag(option, flags); similar != "" {
+				message += fmt.Sprintf(", did you mean %s?", similar)
+			}
+
+			if complete {
+				issues = append(issues, message)
+				continue
+			}
+
+			warnings = append(warnings, message)
+			if i+1 < len(options) && !strings.HasPrefix(options[i+1], "-") {
+				i++
+			}
+			continue
+		}
+
+		used[option] = true
+
+		if hasValue {
+			if i+1 >= len(options) || strings.HasPrefix(options[i+1], "-") {
+				issues = append(issues, fmt.Sprintf("missing argument for flag: %s", option))
+				continue
+			}
+			i++
+		}
+	}
+
+	for _, conflict := range conflictingEmulatorFlags {
+		if used[conflict[0]] && used[conflict[1]] {
+			issues = append(issues, fmt.Sprintf("%s can not be used together with %s", conflict[0], conflict[1]))
+		}
+	}
+
+	return issues, warnings
+}
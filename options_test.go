@@ -0,0 +1,186 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEmulatorHelp(t *testing.T) {
+	tests := []struct {
+		name string
+		help string
+		want map[string]bool
+	}{
+		{
+			name: "empty",
+			help: "",
+			want: map[string]bool{},
+		},
+		{
+			name: "flags with and without argument",
+			help: `Android Emulator usage: emulator [options] [-qemu args]
+  options:
+    -sysdir <dir>                  search for system disk images in <dir>
+    -no-window                     disable graphical window display
+    -gpu <mode>                    set hardware OpenGLES emulation mode
+    -no-snapshot-load              do not auto-start from snapshot: perform a full boot`,
+			want: map[string]bool{
+				"-sysdir":           true,
+				"-no-window":        false,
+				"-gpu":              true,
+				"-no-snapshot-load": false,
+			},
+		},
+		{
+			name: "ignores non option lines",
+			help: `     -qemu args...                 pass arguments to qemu
+ Android Emulator usage: emulator [options]
+-not-indented                     not an option line
+    - not a flag`,
+			want: map[string]bool{
+				"-qemu": false,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseEmulatorHelp(tt.help); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEmulatorHelp() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "", b: "-gpu", want: 4},
+		{a: "-gpu", b: "", want: 4},
+		{a: "-gpu", b: "-gpu", want: 0},
+		{a: "-gup", b: "-gpu", want: 2},
+		{a: "-no-widow", b: "-no-window", want: 1},
+		{a: "-no-windows", b: "-no-window", want: 1},
+		{a: "-no-snapshot", b: "-no-snapshot-load", want: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			if got := editDistance(tt.a, tt.b); got != tt.want {
+				t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateEmulatorOptions(t *testing.T) {
+	flags := map[string]bool{
+		"-gpu":              true,
+		"-no-window":        false,
+		"-no-snapshot-load": false,
+		"-snapshot":         true,
+		"-wipe-data":        false,
+	}
+
+	tests := []struct {
+		name         string
+		options      []string
+		complete     bool
+		wantIssues   []string
+		wantWarnings []string
+	}{
+		{
+			name:         "valid options",
+			options:      []string{"-gpu", "swiftshader_indirect", "-no-window"},
+			complete:     true,
+			wantIssues:   []string{},
+			wantWarnings: []string{},
+		},
+		{
+			name:         "missing argument",
+			options:      []string{"-gpu", "-no-window"},
+			complete:     true,
+			wantIssues:   []string{"missing argument for flag: -gpu"},
+			wantWarnings: []string{},
+		},
+		{
+			name:         "missing argument at the end",
+			options:      []string{"-no-window", "-gpu"},
+			complete:     true,
+			wantIssues:   []string{"missing argument for flag: -gpu"},
+			wantWarnings: []string{},
+		},
+		{
+			name:         "unexpected argument",
+			options:      []string{"-no-window", "swiftshader_indirect"},
+			complete:     true,
+			wantIssues:   []string{"unexpected argument: swiftshader_indirect"},
+			wantWarnings: []string{},
+		},
+		{
+			name:         "conflicting flags",
+			options:      []string{"-wipe-data", "-snapshot", "booted"},
+			complete:     true,
+			wantIssues:   []string{"-wipe-data can not be used together with -snapshot"},
+			wantWarnings: []string{},
+		},
+		{
+			name:         "qemu options are not checked",
+			options:      []string{"-no-window", "-qemu", "-unknown", "value"},
+			complete:     true,
+			wantIssues:   []string{},
+			wantWarnings: []string{},
+		},
+		{
+			name:         "unknown flag with complete flag list",
+			options:      []string{"-no-widow"},
+			complete:     true,
+			wantIssues:   []string{"unknown flag: -no-widow, did you mean -no-window?"},
+			wantWarnings: []string{},
+		},
+		{
+			name:         "unknown flag without similar flag",
+			options:      []string{"-camera-back", "webcam0"},
+			complete:     true,
+			wantIssues:   []string{"unknown flag: -camera-back", "unexpected argument: webcam0"},
+			wantWarnings: []string{},
+		},
+		{
+			name:         "unknown flag with fallback flag list",
+			options:      []string{"-no-widow", "-gpu", "host"},
+			complete:     false,
+			wantIssues:   []string{},
+			wantWarnings: []string{"unknown flag: -no-widow, did you mean -no-window?"},
+		},
+		{
+			name:         "unknown flag value with fallback flag list",
+			options:      []string{"-camera-back", "webcam0", "-no-window"},
+			complete:     false,
+			wantIssues:   []string{},
+			wantWarnings: []string{"unknown flag: -camera-back"},
+		},
+		{
+			name:         "known flags are still checked with fallback flag list",
+			options:      []string{"-camera-back", "webcam0", "-gpu"},
+			complete:     false,
+			wantIssues:   []string{"missing argument for flag: -gpu"},
+			wantWarnings: []string{"unknown flag: -camera-back"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, warnings := validateEmulatorOptions(tt.options, flags, tt.complete)
+			if !reflect.DeepEqual(issues, tt.wantIssues) {
+				t.Errorf("validateEmulatorOptions() issues = %v, want %v", issues, tt.wantIssues)
+			}
+			if !reflect.DeepEqual(warnings, tt.wantWarnings) {
+				t.Errorf("validateEmulatorOptions() warnings = %v, want %v", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/sliceutil"
+)
+
+var appOpModes = []string{"allow", "ignore", "deny", "default", "foreground"}
+
+// permissionGrant is a runtime permission to grant to a package (adb shell pm grant <package> <permission>).
+type permissionGrant struct {
+	pkg        string
+	permission string
+}
+
+// appOpSetting is an app op mode to set for a package (adb shell appops set <package> <op> <mode>).
+type appOpSetting struct {
+	pkg  string
+	op   string
+	mode string
+}
+
+// permissionFailure is a permission or app op which could not be applied, reported in the boot report.
+type permissionFailure struct {
+	Package string `json:"package"`
+	Name    string `json:"name"`
+	Error   string `json:"error"`
+}
+
+// parsePermissionGrants parses the grant_permissions input: one package:permission pair per line,
+// permissions without a package prefix are android.permission.* permissions.
+func parsePermissionGrants(value string) ([]permissionGrant, error) {
+	grants := []permissionGrant{}
+	for _, line := range splitLines(value) {
+		split := strings.Split(line, ":")
+		if len(split) != 2 || strings.TrimSpace(split[0]) == "" || strings.TrimSpace(split[1]) == "" {
+			return nil, fmt.Errorf("invalid permission, should be package:permission: %s", line)
+		}
+
+		permission := strings.TrimSpace(split[1])
+		if !strings.Contains(permission, ".") {
+			permission = "android.permission." + permission
+		}
+		grants = append(grants, permissionGrant{pkg: strings.TrimSpace(split[0]), permission: permission})
+	}
+	return grants, nil
+}
+
+// parseAppOpSettings parses the app_ops input: one package:op:mode setting per line.
+func parseAppOpSettings(value string) ([]appOpSetting, error) {
+	settings := []appOpSetting{}
+	for _, line := range splitLines(value) {
+		split := strings.Split(line, ":")
+		if len(split) != 3 || strings.TrimSpace(split[0]) == "" || strings.TrimSpace(split[1]) == "" {
+			return nil, fmt.Errorf("invalid app op, should be package:op:mode: %s", line)
+		}
+
+		mode := strings.TrimSpace(split[2])
+		if !sliceutil.IsStringInSlice(mode, appOpModes) {
+			return nil, fmt.Errorf("invalid app op mode: %s, available: %s", mode, strings.Join(appOpModes, ", "))
+		}
+		settings = append(settings, appOpSetting{pkg: strings.TrimSpace(split[0]), op: strings.TrimSpace(split[1]), mode: mode})
+	}
+	return settings, nil
+}
+
+func isPackageInstalled(adb adbClient, pkg string) bool {
+	out, err := adb.shell("pm", "path", pkg)
+	return err == nil && strings.HasPrefix(out, "package:")
+}
+
+// grantPermission grants the permission, pm grant prints the reason of the failure even if it exits with 0 on older API levels.
+func grantPermission(adb adbClient, grant permissionGrant) error {
+	out, err := adb.shell("pm", "grant", grant.pkg, grant.permission)
+	if err != nil || out != "" {
+		return fmt.Errorf("pm grant failed, output: %s, error: %v", out, err)
+	}
+	return nil
+}
+
+func setAppOp(adb adbClient, setting appOpSetting) error {
+	out, err := adb.shell("appops", "set", setting.pkg, setting.op, setting.mode)
+	if err != nil || out != "" {
+		return fmt.Errorf("appops set failed, output: %s, error: %v", out, err)
+	}
+	return nil
+}
+
+// applyPermissions grants the permissions and sets the app ops,
+// it returns the ones which could not be applied instead of stopping at the first failure.
+func applyPermissions(adb adbClient, grants []permissionGrant, settings []appOpSetting) []permissionFailure {
+	failures := []permissionFailure{}
+	installed := map[string]bool{}
+	checkInstalled := func(pkg string) error {
+		if _, ok := installed[pkg]; !ok {
+			installed[pkg] = isPackageInstalled(adb, pkg)
+		}
+		if !installed[pkg] {
+			return fmt.Errorf("package is not installed")
+		}
+		return nil
+	}
+
+	for _, grant := range grants {
+		log.Printf("> pm grant %s %s", grant.pkg, grant.permission)
+
+		err := checkInstalled(grant.pkg)
+		if err == nil {
+			err = grantPermission(adb, grant)
+		}
+		if err != nil {
+			log.Warnf("Failed to grant %s to %s, error: %s", grant.permission, grant.pkg, err)
+			failures = append(failures, permissionFailure{Package: grant.pkg, Name: grant.permission, Error: err.Error()})
+		}
+	}
+
+	for _, setting := range settings {
+		log.Printf("> appops set %s %s %s", setting.pkg, setting.op, setting.mode)
+
+		err := checkInstalled(setting.pkg)
+		if err == nil {
+			err = setAppOp(adb, setting)
+		}
+		if err != nil {
+			log.Warnf("Failed to set %s of %s, error: %s", setting.op, setting.pkg, err)
+			failures = append(failures, permissionFailure{Package: setting.pkg, Name: setting.op, Error: err.Error()})
+		}
+	}
+	return failures
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-tools/go-steputils/tools"
+)
+
+// phaseTimeoutError is returned when a boot phase does not finish within its own timeout.
+type phaseTimeoutError struct {
+	phase   string
+	timeout time.Duration
+}
+
+func (err phaseTimeoutError) Error() string {
+	return fmt.Sprintf("%s phase timed out after %.0fs", err.phase, err.timeout.Seconds())
+}
+
+// parseTimeout parses a timeout input given in seconds, an empty value means no timeout.
+func parseTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if seconds < 0 {
+		return 0, fmt.Errorf("negative timeout: %d", seconds)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func phaseDurationEnvKey(name string) string {
+	return "BITRISE_EMULATOR_" + strings.ToUpper(name) + "_DURATION"
+}
+
+// runPhase runs fn as the named boot phase, records its timing in the report, then logs and exports its duration.
+// A zero timeout means the phase is only limited by the overall boot timeout.
+func runPhase(name string, timeout time.Duration, fn func() error) error {
+	report.startPhase(name)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	var timeoutChan <-chan time.Time
+	if timeout > 0 {
+		timeoutChan = time.After(timeout)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+	case <-timeoutChan:
+		return phaseTimeoutError{phase: name, timeout: timeout}
+	}
+
+	elapsed := report.finishPhase(name)
+	log.Printf("> %s phase took %.1fs", name, elapsed.Seconds())
+
+	envKey := phaseDurationEnvKey(name)
+	if err := tools.ExportEnvironmentWithEnvman(envKey, fmt.Sprintf("%.0f", elapsed.Seconds())); err != nil {
+		log.Warnf("Failed to export environment (%s), error: %s", envKey, err)
+	}
+	return nil
+}
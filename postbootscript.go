@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const defaultPostBootCommandTimeout = 60 * time.Second
+
+const (
+	postBootCommandsOnErrorStop     = "stop"
+	postBootCommandsOnErrorContinue = "continue"
+)
+
+var postBootCommandsOnErrorValues = []string{postBootCommandsOnErrorStop, postBootCommandsOnErrorContinue}
+
+// postBootCommandResult is the outcome of a post-boot command, reported in the boot report.
+type postBootCommandResult struct {
+	Command         string  `json:"command"`
+	Output          string  `json:"output"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// looksLikeScriptPth returns whether the single-line input is meant as the path of a script file (like ./scripts/setup.sh),
+// rather than a command.
+func looksLikeScriptPth(value string) bool {
+	return !strings.ContainsAny(value, " \t") && strings.Contains(value, "/") && strings.HasSuffix(value, ".sh")
+}
+
+// postBootCommands returns the commands of the post_boot_commands input,
+// which is either the path of a script file or the commands themselves, one command per line.
+// Empty lines and lines starting with # are skipped.
+func postBootCommands(value string) ([]string, error) {
+	script := value
+	if pth := strings.TrimSpace(value); pth != "" && !strings.Contains(pth, "\n") {
+		if exist, err := pathutil.IsPathExists(pth); err != nil {
+			return nil, fmt.Errorf("failed to check if post-boot script exist, error: %s", err)
+		} else if exist {
+			content, err := ioutil.ReadFile(pth)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read post-boot script (%s), error: %s", pth, err)
+			}
+			script = string(content)
+		} else if looksLikeScriptPth(pth) {
+			return nil, fmt.Errorf("post-boot script does not exist: %s", pth)
+		}
+	}
+
+	commands := []string{}
+	for _, line := range splitLines(script) {
+		if !strings.HasPrefix(line, "#") {
+			commands = append(commands, line)
+		}
+	}
+	return commands, nil
+}
+
+// runShellCommand runs the command with adb shell, killing it if it does not finish in time.
+func runShellCommand(adb adbClient, shellCommand string, timeout time.Duration) (string, error) {
+	var output bytes.Buffer
+	cmd := adb.command("shell", shellCommand).GetCmd()
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return strings.TrimSpace(output.String()), err
+	case <-time.After(timeout):
+		if err := cmd.Process.Kill(); err != nil {
+			log.Warnf("Failed to kill command, error: %s", err)
+		}
+		<-done
+		return strings.TrimSpace(output.String()), fmt.Errorf("timed out after %.0fs", timeout.Seconds())
+	}
+}
+
+// runPostBootCommands runs the commands in order, on error it stops or continues with the next command based on onError.
+func runPostBootCommands(adb adbClient, commands []string, onError string, timeout time.Duration) ([]postBootCommandResult, error) {
+	results := []postBootCommandResult{}
+	failed := 0
+	for _, shellCommand := range commands {
+		log.Printf("> adb shell %s", shellCommand)
+
+		startTime := time.Now()
+		out, err := runShellCommand(adb, shellCommand, timeout)
+		result := postBootCommandResult{Command: shellCommand, Output: out, DurationSeconds: time.Since(startTime).Seconds()}
+		if out != "" {
+			log.Printf("%s", out)
+		}
+
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			failed++
+
+			if onError == postBootCommandsOnErrorStop {
+				return results, fmt.Errorf("post-boot command (%s) failed, error: %s", shellCommand, err)
+			}
+			log.Warnf("Post-boot command failed, error: %s", err)
+			continue
+		}
+		results = append(results, result)
+	}
+
+	if failed > 0 {
+		log.Warnf("%d of %d post-boot command(s) failed", failed, len(commands))
+	}
+	return results, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPostBootCommands(t *testing.T) {
+	scriptPth := filepath.Join(t.TempDir(), "setup.sh")
+	if err := ioutil.WriteFile(scriptPth, []byte("# comment\nsvc wifi disable\n\nsettings put global stay_on_while_plugged_in 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			value: "",
+			want:  []string{},
+		},
+		{
+			name:  "commands",
+			value: "# disable the spell checker\nsettings put secure spell_checker_enabled 0\n\n svc wifi disable \n",
+			want:  []string{"settings put secure spell_checker_enabled 0", "svc wifi disable"},
+		},
+		{
+			name:  "single command",
+			value: "svc wifi disable",
+			want:  []string{"svc wifi disable"},
+		},
+		{
+			name:  "device script",
+			value: "sh /sdcard/setup.sh",
+			want:  []string{"sh /sdcard/setup.sh"},
+		},
+		{
+			name:  "script file",
+			value: scriptPth,
+			want:  []string{"svc wifi disable", "settings put global stay_on_while_plugged_in 3"},
+		},
+		{
+			name:    "missing script file",
+			value:   filepath.Join(filepath.Dir(scriptPth), "missing.sh"),
+			wantErr: true,
+		},
+		{
+			name:    "missing relative script file",
+			value:   "./scripts/setup.sh",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := postBootCommands(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("postBootCommands() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("postBootCommands() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/hashicorp/go-version"
+)
+
+const defaultBootSnapshotName = "default_boot"
+
+const (
+	snapshotStatusUnknown  = "unknown"
+	snapshotStatusLoaded   = "loaded"
+	snapshotStatusColdBoot = "cold_boot"
+)
+
+var (
+	snapshotLoadedRegexp   = regexp.MustCompile(`(?i)(successfully loaded snapshot|snapshot '.*' loaded)`)
+	snapshotColdBootRegexp = regexp.MustCompile(`(?i)(cold boot|failed to load snapshot|snapshot .* (is incompatible|could not be loaded))`)
+)
+
+// snapshotLoadStatus tracks whether the emulator loaded a snapshot, based on its output.
+type snapshotLoadStatus struct {
+	mutex  sync.Mutex
+	status string
+	reason string
+}
+
+func newSnapshotLoadStatus() *snapshotLoadStatus {
+	return &snapshotLoadStatus{status: snapshotStatusUnknown}
+}
+
+func (status *snapshotLoadStatus) observe(line string) {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+
+	if snapshotLoadedRegexp.MatchString(line) {
+		status.status = snapshotStatusLoaded
+		status.reason = ""
+	} else if snapshotColdBootRegexp.MatchString(line) && status.status != snapshotStatusLoaded {
+		status.status = snapshotStatusColdBoot
+		status.reason = strings.TrimSpace(line)
+	}
+}
+
+func (status *snapshotLoadStatus) get() (string, string) {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+
+	return status.status, status.reason
+}
+
+func snapshotDir(avdName, snapshotName string) string {
+	return filepath.Join(avdImageDir(avdName), "snapshots", snapshotName)
+}
+
+// noSnapshotLoadInputOption makes the emulator cold boot instead of loading the quick boot snapshot.
+func noSnapshotLoadInputOption() inputOption {
+	return inputOption{args: []string{"-no-snapshot-load"}, overriddenBy: []string{"-snapshot", "-no-snapshot", "-no-snapshot-load", "-force-snapshot-load"}}
+}
+
+// snapshotInputOption returns the option to boot from the named snapshot.
+// If the snapshot does not exist it returns -no-snapshot-load (so the emulator cold boots instead of loading the quick boot snapshot) and false.
+func snapshotInputOption(avdName, snapshotName string) (inputOption, bool) {
+	if snapshotName == "" {
+		return inputOption{}, false
+	}
+
+	dir := snapshotDir(avdName, snapshotName)
+	if exist, err := pathutil.IsDirExists(dir); err != nil {
+		log.Warnf("Failed to check if snapshot (%s) exists, error: %s", snapshotName, err)
+	} else if !exist {
+		log.Warnf("Snapshot (%s) does not exist at: %s, the emulator will cold boot (-no-snapshot-load)", snapshotName, dir)
+		return inputOption{args: []string{"-no-snapshot-load"}, overriddenBy: []string{"-snapshot", "-no-snapshot", "-no-snapshot-load", "-force-snapshot-load"}}, false
+	}
+
+	return inputOption{args: []string{"-snapshot", snapshotName}, overriddenBy: []string{"-snapshot", "-no-snapshot", "-no-snapshot-load"}}, true
+}
+
+// saveSnapshot saves the current state of the device as a named snapshot through the emulator console.
+func saveSnapshot(adb adbClient, snapshotName string) error {
+	out, err := adb.command("emu", "avd", "snapshot", "save", snapshotName).RunAndReturnTrimmedCombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot, output: %s, error: %s", out, err)
+	}
+	if strings.Contains(out, "KO") {
+		return fmt.Errorf("failed to save snapshot: %s", out)
+	}
+	return nil
+}
+
+const snapshotMetadataFileName = "bitrise_snapshot_metadata.json"
+
+// snapshot.pb field numbers, see the emulator's snapshot.proto
+const (
+	snapshotPbCreationTimeField           = 2
+	snapshotPbFailedToLoadReasonCodeField = 7
+)
+
+// snapshotMetadata is saved next to the snapshots saved by the step.
+type snapshotMetadata struct {
+	EmulatorVersion string    `json:"emulator_version"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// snapshotInfo describes a snapshot of an AVD.
+type snapshotInfo struct {
+	name                   string
+	dir                    string
+	size                   int64
+	createdAt              time.Time
+	emulatorVersion        string
+	failedToLoadReasonCode uint64
+}
+
+// parseSnapshotPb reads the top-level varint fields of a snapshot.pb file (protobuf wire format).
+func parseSnapshotPb(content []byte) (map[uint64]uint64, error) {
+	fields := map[uint64]uint64{}
+	for len(content) > 0 {
+		key, n := binary.Uvarint(content)
+		if n <= 0 {
+			return nil, errors.New("invalid field key")
+		}
+		content = content[n:]
+
+		fieldNumber, wireType := key>>3, key&0x7
+		switch wireType {
+		case 0:
+			value, n := binary.Uvarint(content)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid varint in field %d", fieldNumber)
+			}
+			fields[fieldNumber] = value
+			content = content[n:]
+		case 1:
+			if len(content) < 8 {
+				return nil, fmt.Errorf("truncated field %d", fieldNumber)
+			}
+			content = content[8:]
+		case 2:
+			length, n := binary.Uvarint(content)
+			if n <= 0 || uint64(len(content)-n) < length {
+				return nil, fmt.Errorf("truncated field %d", fieldNumber)
+			}
+			content = content[n+int(length):]
+		case 5:
+			if len(content) < 4 {
+				return nil, fmt.Errorf("truncated field %d", fieldNumber)
+			}
+			content = content[4:]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d in field %d", wireType, fieldNumber)
+		}
+	}
+	return fields, nil
+}
+
+func dirSize(dir string) (int64, error) {
+	size := int64(0)
+	err := filepath.Walk(dir, func(pth string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func readSnapshotInfo(dir string) (snapshotInfo, error) {
+	info := snapshotInfo{name: filepath.Base(dir), dir: dir}
+
+	size, err := dirSize(dir)
+	if err != nil {
+		return snapshotInfo{}, fmt.Errorf("failed to calculate snapshot size, error: %s", err)
+	}
+	info.size = size
+
+	if fileInfo, err := os.Stat(dir); err == nil {
+		info.createdAt = fileInfo.ModTime()
+	}
+
+	if content, err := ioutil.ReadFile(filepath.Join(dir, "snapshot.pb")); err == nil {
+		fields, err := parseSnapshotPb(content)
+		if err != nil {
+			log.Warnf("Failed to parse snapshot.pb of %s, error: %s", info.name, err)
+		} else {
+			if creationTime, ok := fields[snapshotPbCreationTimeField]; ok && creationTime > 0 {
+				info.createdAt = time.Unix(int64(creationTime), 0)
+			}
+			info.failedToLoadReasonCode = fields[snapshotPbFailedToLoadReasonCodeField]
+		}
+	}
+
+	if content, err := ioutil.ReadFile(filepath.Join(dir, snapshotMetadataFileName)); err == nil {
+		var metadata snapshotMetadata
+		if err := json.Unmarshal(content, &metadata); err != nil {
+			log.Warnf("Failed to parse snapshot metadata of %s, error: %s", info.name, err)
+		} else {
+			info.emulatorVersion = metadata.EmulatorVersion
+		}
+	}
+
+	return info, nil
+}
+
+func listSnapshots(avdName string) ([]snapshotInfo, error) {
+	pattern := filepath.Join(avdImageDir(avdName), "snapshots", "*")
+	dirs, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("glob failed with pattern (%s), error: %s", pattern, err)
+	}
+
+	snapshots := []snapshotInfo{}
+	for _, dir := range dirs {
+		if isDir, err := pathutil.IsDirExists(dir); err != nil || !isDir {
+			continue
+		}
+
+		info, err := readSnapshotInfo(dir)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, info)
+	}
+	return snapshots, nil
+}
+
+func writeSnapshotMetadata(avdName, snapshotName string, emulatorVersion *version.Version) error {
+	metadata := snapshotMetadata{CreatedAt: time.Now()}
+	if emulatorVersion != nil {
+		metadata.EmulatorVersion = emulatorVersion.String()
+	}
+
+	bytes, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(snapshotDir(avdName, snapshotName), snapshotMetadataFileName), bytes, 0644)
+}
+
+// incompatibleReason returns why the snapshot can not be loaded by the installed emulator, or an empty string.
+func (info snapshotInfo) incompatibleReason(emulatorVersion *version.Version) string {
+	if info.failedToLoadReasonCode != 0 {
+		return fmt.Sprintf("the emulator failed to load it before (reason code: %d)", info.failedToLoadReasonCode)
+	}
+	if emulatorVersion != nil && info.emulatorVersion != "" && info.emulatorVersion != emulatorVersion.String() {
+		return fmt.Sprintf("saved by emulator %s, installed: %s", info.emulatorVersion, emulatorVersion)
+	}
+	return ""
+}
+
+func formatSize(size int64) string {
+	return fmt.Sprintf("%.1f MB", float64(size)/1024/1024)
+}
+
+// pruneSnapshots deletes the incompatible snapshots (if deleteIncompatible is set)
+// and the snapshots older than maxAge (if it is not zero), and returns the reclaimed disk space.
+func pruneSnapshots(snapshots []snapshotInfo, emulatorVersion *version.Version, deleteIncompatible bool, maxAge time.Duration) (int64, error) {
+	reclaimed := int64(0)
+	for _, snapshot := range snapshots {
+		reason := ""
+		if deleteIncompatible {
+			reason = snapshot.incompatibleReason(emulatorVersion)
+		}
+		if reason == "" && maxAge > 0 && time.Since(snapshot.createdAt) > maxAge {
+			reason = fmt.Sprintf("created at %s", snapshot.createdAt.Format(time.RFC3339))
+		}
+		if reason == "" {
+			continue
+		}
+
+		log.Printf("Deleting snapshot %s: %s", snapshot.name, reason)
+		if err := os.RemoveAll(snapshot.dir); err != nil {
+			return reclaimed, fmt.Errorf("failed to delete snapshot (%s), error: %s", snapshot.dir, err)
+		}
+		reclaimed += snapshot.size
+	}
+	return reclaimed, nil
+}
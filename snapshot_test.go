@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSnapshotPb(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    map[uint64]uint64
+		wantErr bool
+	}{
+		{
+			name:    "empty",
+			content: []byte{},
+			want:    map[uint64]uint64{},
+		},
+		{
+			name: "varint fields",
+			// field 2 (creation time): 1550000000, field 7 (failed to load reason code): 3
+			content: []byte{0x10, 0x80, 0xbf, 0x8c, 0xe3, 0x05, 0x38, 0x03},
+			want:    map[uint64]uint64{2: 1550000000, 7: 3},
+		},
+		{
+			name: "skips non varint fields",
+			// field 1: length-delimited "ab", field 3: fixed64, field 4: fixed32, field 7: 1
+			content: []byte{0x0a, 0x02, 'a', 'b', 0x19, 1, 2, 3, 4, 5, 6, 7, 8, 0x25, 1, 2, 3, 4, 0x38, 0x01},
+			want:    map[uint64]uint64{7: 1},
+		},
+		{
+			name:    "truncated key",
+			content: []byte{0x80},
+			wantErr: true,
+		},
+		{
+			name:    "missing varint value",
+			content: []byte{0x10},
+			wantErr: true,
+		},
+		{
+			name:    "truncated varint value",
+			content: []byte{0x10, 0x80, 0xbf},
+			wantErr: true,
+		},
+		{
+			name:    "truncated length-delimited field",
+			content: []byte{0x0a, 0x05, 'a', 'b'},
+			wantErr: true,
+		},
+		{
+			name:    "truncated length of length-delimited field",
+			content: []byte{0x0a, 0x80},
+			wantErr: true,
+		},
+		{
+			name:    "length-delimited field longer than the content",
+			content: []byte{0x0a, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+			wantErr: true,
+		},
+		{
+			name:    "truncated fixed64 field",
+			content: []byte{0x19, 1, 2, 3},
+			wantErr: true,
+		},
+		{
+			name:    "truncated fixed32 field",
+			content: []byte{0x25, 1, 2},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported wire type",
+			content: []byte{0x0b},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSnapshotPb(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSnapshotPb() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSnapshotPb() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
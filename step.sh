@@ -12,4 +12,4 @@ rsync -avh --quiet "${THIS_SCRIPT_DIR}/" "${full_package_path}/"
 
 export GOPATH="${tmp_gopath_dir}"
 export GO15VENDOREXPERIMENT=1
-go run "${full_package_path}/main.go"
\ No newline at end of file
+go run "${full_package_path}"
\ No newline at end of file
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	unlockTimeout       = 2 * time.Minute
+	unlockRetryInterval = 2 * time.Second
+)
+
+var (
+	screenOnRegexp        = regexp.MustCompile(`mWakefulness=Awake|Display Power: state=ON`)
+	keyguardShowingRegexp = regexp.MustCompile(`(mShowingLockscreen|mDreamingLockscreen|isStatusBarKeyguard|mKeyguardShowing)=true`)
+)
+
+func apiLevel(adb adbClient) (int, error) {
+	out, err := adb.shell("getprop", "ro.build.version.sdk")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get API level, output: %s, error: %s", out, err)
+	}
+	return strconv.Atoi(out)
+}
+
+func isScreenOn(adb adbClient) (bool, error) {
+	out, err := adb.shell("dumpsys", "power")
+	if err != nil {
+		return false, fmt.Errorf("dumpsys power failed, error: %s", err)
+	}
+	return screenOnRegexp.MatchString(out), nil
+}
+
+func isKeyguardShowing(adb adbClient) (bool, error) {
+	out, err := adb.shell("dumpsys", "window")
+	if err != nil {
+		return false, fmt.Errorf("dumpsys window failed, error: %s", err)
+	}
+	return keyguardShowingRegexp.MatchString(out), nil
+}
+
+// isUnlocked tells whether the screen is on and the keyguard is dismissed.
+func isUnlocked(adb adbClient) (bool, error) {
+	screenOn, err := isScreenOn(adb)
+	if err != nil || !screenOn {
+		return false, err
+	}
+
+	keyguardShowing, err := isKeyguardShowing(adb)
+	if err != nil {
+		return false, err
+	}
+	return !keyguardShowing, nil
+}
+
+func sendUnlockEvents(adb adbClient, apiLevel int) error {
+	// KEYCODE_WAKEUP is available from API 20, KEYCODE_POWER would toggle the screen
+	wakeUpKey := "KEYCODE_WAKEUP"
+	if apiLevel < 20 {
+		if screenOn, err := isScreenOn(adb); err != nil {
+			return err
+		} else if screenOn {
+			wakeUpKey = ""
+		} else {
+			wakeUpKey = "KEYCODE_POWER"
+		}
+	}
+	if wakeUpKey != "" {
+		if out, err := adb.shell("input", "keyevent", wakeUpKey); err != nil {
+			return fmt.Errorf("failed to wake up the screen, output: %s, error: %s", out, err)
+		}
+	}
+
+	// wm dismiss-keyguard is available from API 23
+	if apiLevel >= 23 {
+		if out, err := adb.shell("wm", "dismiss-keyguard"); err != nil {
+			return fmt.Errorf("failed to dismiss the keyguard, output: %s, error: %s", out, err)
+		}
+	} else if out, err := adb.shell("input", "keyevent", "KEYCODE_MENU"); err != nil {
+		return fmt.Errorf("failed to dismiss the keyguard, output: %s, error: %s", out, err)
+	}
+	return nil
+}
+
+// unlockDevice wakes the screen and dismisses the keyguard, then verifies the device is unlocked,
+// retrying until it succeeds or unlockTimeout elapses.
+func unlockDevice(adb adbClient) error {
+	level, err := apiLevel(adb)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(unlockTimeout)
+	for {
+		if err := sendUnlockEvents(adb, level); err != nil {
+			log.Warnf("> %s", err)
+		}
+
+		time.Sleep(unlockRetryInterval)
+
+		unlocked, err := isUnlocked(adb)
+		if err != nil {
+			log.Warnf("> Failed to check if device is unlocked, error: %s", err)
+		} else if unlocked {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("device is still locked after %.0fs", unlockTimeout.Seconds())
+		}
+
+		log.Printf("> Device is still locked, retrying...")
+		report.retryPhase(phaseUnlock)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-version"
+)
+
+const (
+	unsupportedOptionPolicyWarn = "warn"
+	unsupportedOptionPolicyFail = "fail"
+)
+
+// optionRequirement is the minimum emulator version supporting an emulator option.
+// If value is set, the requirement applies only to the option used with that value.
+type optionRequirement struct {
+	option     string
+	value      string
+	minVersion string
+}
+
+var optionRequirements = []optionRequirement{
+	{option: "-gpu", value: "swiftshader_indirect", minVersion: "27.1.0"},
+	{option: "-gpu", value: "angle_indirect", minVersion: "27.1.0"},
+	{option: "-no-snapshot", minVersion: "27.0.0"},
+	{option: "-no-snapshot-load", minVersion: "27.0.0"},
+	{option: "-no-snapshot-save", minVersion: "27.0.0"},
+	{option: "-snapshot", minVersion: "27.0.0"},
+	{option: "-qt-hide-window", minVersion: "26.1.0"},
+	{option: "-accel", minVersion: "25.2.0"},
+	{option: "-accel-check", minVersion: "25.2.0"},
+}
+
+func (requirement optionRequirement) String() string {
+	if requirement.value != "" {
+		return requirement.option + " " + requirement.value
+	}
+	return requirement.option
+}
+
+// unsupportedOptions returns the requirements of the given emulator options not met by the emulator version.
+func unsupportedOptions(options []string, emulatorVersion *version.Version) ([]optionRequirement, error) {
+	unsupported := []optionRequirement{}
+	for i, option := range options {
+		value := ""
+		if i+1 < len(options) {
+			value = options[i+1]
+		}
+
+		for _, requirement := range optionRequirements {
+			if requirement.option != option || (requirement.value != "" && requirement.value != value) {
+				continue
+			}
+
+			minVersion, err := version.NewVersion(requirement.minVersion)
+			if err != nil {
+				return nil, fmt.Errorf("invalid minimum version (%s) for %s, error: %s", requirement.minVersion, requirement, err)
+			}
+			if emulatorVersion.LessThan(minVersion) {
+				unsupported = append(unsupported, requirement)
+			}
+		}
+	}
+	return unsupported, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	watchdogCommand          = "watchdog"
+	healthTimelineFileName   = "emulator_health.jsonl"
+	watchdogMaxMissedChecks  = 3
+	defaultWatchdogInterval  = 30 * time.Second
+	watchdogLogcatRetryDelay = 5 * time.Second
+)
+
+// logcatHealthPatterns maps the logcat lines recorded in the health timeline to their event names.
+var logcatHealthPatterns = []struct {
+	event  string
+	regexp *regexp.Regexp
+}{
+	{event: "system_crash", regexp: regexp.MustCompile(`FATAL EXCEPTION IN SYSTEM PROCESS`)},
+	{event: "app_crash", regexp: regexp.MustCompile(`FATAL EXCEPTION: `)},
+	{event: "native_crash", regexp: regexp.MustCompile(`Fatal signal \d+`)},
+	{event: "anr", regexp: regexp.MustCompile(`ANR in `)},
+}
+
+// healthEvent is a line of the health timeline file.
+type healthEvent struct {
+	Time          time.Time `json:"time"`
+	Event         string    `json:"event"`
+	State         string    `json:"state,omitempty"`
+	BootCompleted *bool     `json:"boot_completed,omitempty"`
+	Message       string    `json:"message,omitempty"`
+}
+
+// healthTimeline appends the events to the health timeline file as JSON lines.
+type healthTimeline struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// add appends the event, errors are ignored as the detached watchdog has nowhere to report them.
+func (timeline *healthTimeline) add(event healthEvent) {
+	timeline.mutex.Lock()
+	defer timeline.mutex.Unlock()
+
+	event.Time = time.Now()
+	if bytes, err := json.Marshal(event); err == nil {
+		_, _ = timeline.file.Write(append(bytes, '\n'))
+	}
+}
+
+// startWatchdog starts the health watchdog as a separate process of the step's binary,
+// detached from the step, so it keeps running after the step finishes.
+func startWatchdog(adb adbClient, outputDir string, interval time.Duration) (string, int, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get the step's executable, error: %s", err)
+	}
+
+	if err := os.MkdirAll(outputDir, 0777); err != nil {
+		return "", 0, fmt.Errorf("failed to create output dir (%s), error: %s", outputDir, err)
+	}
+	timelinePth := filepath.Join(outputDir, healthTimelineFileName)
+
+	cmd := exec.Command(executable, watchdogCommand, adb.binPth, adb.serial, timelinePth, strconv.Itoa(int(interval.Seconds())))
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return "", 0, fmt.Errorf("failed to start watchdog, error: %s", err)
+	}
+	pid := cmd.Process.Pid
+	if err := cmd.Process.Release(); err != nil {
+		log.Warnf("Failed to release watchdog process, error: %s", err)
+	}
+	return timelinePth, pid, nil
+}
+
+// watchLogcat records the crashes and ANRs of the device's logcat until logcat exits.
+func watchLogcat(adb adbClient, timeline *healthTimeline) error {
+	// -T 1: skip the lines logged before the watchdog started
+	cmd := adb.command("logcat", "-v", "time", "-T", "1").GetCmd()
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for _, pattern := range logcatHealthPatterns {
+			if pattern.regexp.MatchString(line) {
+				timeline.add(healthEvent{Event: pattern.event, Message: line})
+				break
+			}
+		}
+	}
+	return cmd.Wait()
+}
+
+// checkHealth records the device state and whether the device is booted.
+func checkHealth(adb adbClient, timeline *healthTimeline) bool {
+	state, err := adb.command("get-state").RunAndReturnTrimmedCombinedOutput()
+	if err != nil || state != "device" {
+		timeline.add(healthEvent{Event: "check", State: "missing", Message: state})
+		return false
+	}
+
+	out, err := adb.shell("getprop", "sys.boot_completed")
+	bootCompleted := err == nil && out == "1"
+	timeline.add(healthEvent{Event: "check", State: state, BootCompleted: &bootCompleted})
+	return true
+}
+
+// runWatchdog periodically checks the device and watches its logcat,
+// it exits once the device is missing for watchdogMaxMissedChecks consecutive checks.
+func runWatchdog(args []string) error {
+	if len(args) != 4 {
+		return fmt.Errorf("usage: %s <adb> <serial> <timeline path> <interval seconds>", watchdogCommand)
+	}
+
+	seconds, err := strconv.Atoi(args[3])
+	if err != nil || seconds <= 0 {
+		return fmt.Errorf("invalid interval: %s", args[3])
+	}
+	interval := time.Duration(seconds) * time.Second
+
+	file, err := os.OpenFile(args[2], os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	adb := adbClient{binPth: args[0], serial: args[1]}
+	timeline := &healthTimeline{file: file}
+	timeline.add(healthEvent{Event: "watchdog_started"})
+
+	go func() {
+		for {
+			if err := watchLogcat(adb, timeline); err != nil {
+				timeline.add(healthEvent{Event: "logcat_stopped", Message: err.Error()})
+			}
+			time.Sleep(watchdogLogcatRetryDelay)
+		}
+	}()
+
+	missedChecks := 0
+	for {
+		if checkHealth(adb, timeline) {
+			missedChecks = 0
+		} else {
+			missedChecks++
+		}
+
+		if missedChecks >= watchdogMaxMissedChecks {
+			timeline.add(healthEvent{Event: "device_lost"})
+			return file.Close()
+		}
+		time.Sleep(interval)
+	}
+}